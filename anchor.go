@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// anchorWindow is how many lines of context around each occurrence
+// --prefer-longest-unique-anchor looks at before giving up.
+const anchorWindow = 10
+
+// uniqueAnchor picks one of several occurrences of a search block by the file
+// context around them. Each occurrence is widened a line at a time on both
+// sides, and at the first width where some widened region occurs only once in
+// content, the occurrence is picked if it is the only one with a unique
+// region. It reports false when no width up to anchorWindow singles one out,
+// including when two occurrences become unique at the same width, since
+// nothing then says which one was meant. Widening stops as soon as an
+// occurrence runs out of lines, so that being near the start or end of the
+// file doesn't count as context.
+func uniqueAnchor(content string, matches []span) (span, int, bool) {
+	for width := 1; width <= anchorWindow; width++ {
+		unique := -1
+		for i, m := range matches {
+			start, end, ok := widenByLines(content, m, width)
+			if !ok {
+				return span{}, 0, false
+			}
+			if countOverlapping(content, content[start:end]) != 1 {
+				continue
+			}
+			if unique != -1 {
+				return span{}, 0, false
+			}
+			unique = i
+		}
+		if unique != -1 {
+			return matches[unique], width, true
+		}
+	}
+	return span{}, 0, false
+}
+
+// widenByLines extends m to the start of the line n lines before it and the
+// end of the line n lines after it. If there aren't that many lines on either
+// side, it stops at the end of content there and reports false; a line break
+// at the very end of content does not start another line.
+func widenByLines(content string, m span, n int) (start, end int, ok bool) {
+	ok = true
+	start = strings.LastIndexByte(content[:m.start], '\n') + 1
+	for i := 0; i < n; i++ {
+		if start == 0 {
+			ok = false
+			break
+		}
+		start = strings.LastIndexByte(content[:start-1], '\n') + 1
+	}
+
+	end = m.end
+	if end > m.start && content[end-1] == '\n' {
+		// The match ends its last line; start from that line's end
+		end--
+	}
+	end = lineEndAt(content, end)
+	for i := 0; i < n; i++ {
+		if end >= len(content)-1 {
+			ok = false
+			break
+		}
+		end = lineEndAt(content, end+1)
+	}
+	return start, end, ok
+}
+
+// lineEndAt returns the offset of the first line break at or after offset,
+// or the end of content if there is none.
+func lineEndAt(content string, offset int) int {
+	if i := strings.IndexByte(content[offset:], '\n'); i != -1 {
+		return offset + i
+	}
+	return len(content)
+}
+
+// countOverlapping counts the occurrences of s in content, including ones
+// that overlap.
+func countOverlapping(content, s string) int {
+	count := 0
+	for i := 0; ; {
+		j := strings.Index(content[i:], s)
+		if j == -1 {
+			return count
+		}
+		count++
+		i += j + 1
+	}
+}
+
+// anchorNote describes how uniqueAnchor resolved an ambiguous match.
+func anchorNote(content string, m span, width, total int) string {
+	line := strings.Count(content[:m.start], "\n") + 1
+	return fmt.Sprintf("search block matched %d times; picked the one at line %d, the only one whose %d surrounding lines occur once", total, line, width)
+}
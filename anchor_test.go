@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestApplyEditUniqueAnchor(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		want     string
+		wantNote string
+		wantErr  error
+	}{
+		{
+			name:     "occurrence in a distinct context",
+			content:  "func a() {\n\treturn nil\n}\nfunc b() {\n\treturn nil\n}\nfunc a() {\n\treturn nil\n}\n",
+			want:     "func a() {\n\treturn nil\n}\nfunc b() {\n\treturn err\n}\nfunc a() {\n\treturn nil\n}\n",
+			wantNote: "line 5, the only one whose 1 surrounding lines",
+		},
+		{
+			name:     "wider context",
+			content:  "x\n{\n\treturn nil\n}\nx\n{\n\treturn nil\n}\nx\ny\n{\n\treturn nil\n}\nx\n",
+			want:     "x\n{\n\treturn nil\n}\nx\n{\n\treturn nil\n}\nx\ny\n{\n\treturn err\n}\nx\n",
+			wantNote: "line 12, the only one whose 2 surrounding lines",
+		},
+		{
+			name:    "two occurrences stand out at once",
+			content: "a\n\treturn nil\nx\nb\n\treturn nil\nx\n",
+			wantErr: errAmbiguous,
+		},
+		{
+			name:    "identical surroundings",
+			content: "a\n\treturn nil\na\n\treturn nil\na\n\treturn nil\n",
+			wantErr: errAmbiguous,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, "\treturn nil", "\treturn err", editOptions{uniqueAnchor: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyEdit() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+			if len(result.notes) != 1 || !strings.Contains(result.notes[0], tt.wantNote) {
+				t.Errorf("applyEdit() notes = %q, want one containing %q", result.notes, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestWidenByLines(t *testing.T) {
+	content := "one\ntwo\nthree four\nfive\nsix\n"
+	m := span{strings.Index(content, "four"), strings.Index(content, "four") + len("four")}
+	tests := []struct {
+		n      int
+		want   string
+		wantOK bool
+	}{
+		{0, "three four", true},
+		{1, "two\nthree four\nfive", true},
+		{2, "one\ntwo\nthree four\nfive\nsix", true},
+		{3, "one\ntwo\nthree four\nfive\nsix", false},
+	}
+	for _, tt := range tests {
+		start, end, ok := widenByLines(content, m, tt.n)
+		if ok != tt.wantOK || content[start:end] != tt.want {
+			t.Errorf("widenByLines(%d) = %q, %v, want %q, %v", tt.n, content[start:end], ok, tt.want, tt.wantOK)
+		}
+	}
+}
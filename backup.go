@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// defaultBackupSuffix is appended to the filename of backups unless a suffix
+// is given with -i.
+const defaultBackupSuffix = ".bak"
+
+// backupName returns the path of the n-th backup of filename. With n == 0 it
+// is the single unrotated backup.
+func backupName(filename, suffix string, n int) string {
+	if n == 0 {
+		return filename + suffix
+	}
+	return fmt.Sprintf("%s%s.%d", filename, suffix, n)
+}
+
+// writeBackup saves data as a backup of filename, named by appending suffix.
+// With keep > 0 existing backups are rotated to make room, keeping at most
+// keep of them with filename<suffix>.1 the most recent. Every step is a
+// rename, so an interrupted rotation never loses the newest complete backup.
+func writeBackup(filename string, data []byte, suffix string, keep int) error {
+	perm := fs.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	// Write the new backup next to its final location first
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".bak-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	if keep > 0 {
+		for n := keep - 1; n >= 1; n-- {
+			err := os.Rename(backupName(filename, suffix, n), backupName(filename, suffix, n+1))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		return os.Rename(tmp.Name(), backupName(filename, suffix, 1))
+	}
+	return os.Rename(tmp.Name(), backupName(filename, suffix, 0))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteBackup(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+
+	if err := writeBackup(filename, []byte("first"), defaultBackupSuffix, 0); err != nil {
+		t.Fatalf("writeBackup() error = %v", err)
+	}
+	if err := writeBackup(filename, []byte("second"), defaultBackupSuffix, 0); err != nil {
+		t.Fatalf("writeBackup() error = %v", err)
+	}
+
+	assertFileContent(t, filename+".bak", "second")
+}
+
+func TestWriteBackupSuffix(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+
+	if err := writeBackup(filename, []byte("plain"), ".orig", 0); err != nil {
+		t.Fatalf("writeBackup() error = %v", err)
+	}
+	if err := writeBackup(filename, []byte("rotated"), "~", 2); err != nil {
+		t.Fatalf("writeBackup() with rotation error = %v", err)
+	}
+
+	assertFileContent(t, filename+".orig", "plain")
+	assertFileContent(t, filename+"~.1", "rotated")
+}
+
+func TestWriteBackupRotation(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+
+	for _, content := range []string{"one", "two", "three", "four"} {
+		if err := writeBackup(filename, []byte(content), defaultBackupSuffix, 3); err != nil {
+			t.Fatalf("writeBackup(%q) error = %v", content, err)
+		}
+	}
+
+	assertFileContent(t, filename+".bak.1", "four")
+	assertFileContent(t, filename+".bak.2", "three")
+	assertFileContent(t, filename+".bak.3", "two")
+	if _, err := os.Stat(filename + ".bak.4"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("oldest backup was not removed: %v", err)
+	}
+}
+
+func assertFileContent(t *testing.T, filename, want string) {
+	t.Helper()
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("%s content = %q, want %q", filepath.Base(filename), got, want)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// editJob is one file to edit as part of a batch. A job whose edit could not
+// be prepared carries the error instead.
+type editJob struct {
+	filename string
+	edit     editFunc
+	err      error
+}
+
+// exitPartial is the exit code when every file was edited but --best-effort
+// skipped some blocks.
+const exitPartial = 2
+
+// runBatch applies every job in turn, reporting each result, and returns the
+// exit code for the whole batch. A failing job does not stop the others.
+func runBatch(jobs []editJob, opts runOptions) int {
+	if opts.deterministic {
+		sortJobs(jobs)
+	}
+	if opts.survey {
+		return runSurvey(os.Stdout, jobs, opts)
+	}
+
+	var summary batchSummary
+	var failures []batchFailure
+	partial := false
+	// Collected for --summary-json, which replaces the per-file output
+	var files []jsonResult
+	// Collected for --emit-patch
+	var patch strings.Builder
+	total := 0
+	start := time.Now()
+
+	var out io.Writer = os.Stdout
+	if opts.pager && opts.dryRun && !opts.jsonOutput && !opts.lspEdit && isTerminal(os.Stdout) {
+		pager, wait, err := startPager(os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting pager: %v\n", err)
+		} else {
+			out = pager
+			defer wait()
+		}
+	}
+	for _, job := range jobs {
+		err := job.err
+		var result editResult
+		if err == nil {
+			if opts.prompt != nil {
+				opts.prompt.filename = job.filename
+			}
+			result, err = editFile(job.filename, job.edit, opts)
+		}
+
+		switch {
+		case err == nil && result.skipped != "":
+			summary.unchanged = append(summary.unchanged, job.filename)
+		case err == nil:
+			summary.edited = append(summary.edited, job.filename)
+		case opts.reportUnchanged && errors.Is(err, errSearchNotFound):
+			summary.unchanged = append(summary.unchanged, job.filename)
+			if opts.verbose {
+				fmt.Fprintf(os.Stderr, "Unchanged %s: search block not found\n", job.filename)
+			}
+			if opts.summaryJSON {
+				files = append(files, jsonResult{SchemaVersion: jsonSchemaVersion, File: job.filename, Status: statusUnchanged, Reason: "search block not found"})
+			}
+			continue
+		default:
+			summary.failed = append(summary.failed, job.filename)
+			failures = append(failures, batchFailure{filename: job.filename, err: err})
+			if opts.summaryJSON {
+				files = append(files, errorResult(job.filename, err))
+			} else if opts.jsonOutput {
+				if err := writeJSON(os.Stdout, errorResult(job.filename, err)); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing JSON output: %v\n", err)
+					return 1
+				}
+			}
+			if opts.jsonErrors {
+				writeJSONError(os.Stderr, newJSONError(job.filename, err))
+			} else if len(jobs) > 1 {
+				fmt.Fprintf(os.Stderr, "%s: Error %v\n", job.filename, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			}
+			continue
+		}
+
+		if opts.verbose && result.skipped == "" {
+			line, column := matchPosition(result, opts.position)
+			fmt.Fprintf(os.Stderr, "%s: edit at line %d, column %d\n", job.filename, line, column)
+		}
+		for i, block := range result.blocks {
+			if errors.Is(block.err, errDeclined) {
+				fmt.Fprintf(os.Stderr, "%s: skipped block %d: declined\n", job.filename, i+1)
+			} else if block.err != nil {
+				fmt.Fprintf(os.Stderr, "%s: skipped block %d: %v\n", job.filename, i+1, block.err)
+				failures = append(failures, batchFailure{filename: job.filename, block: i + 1, err: block.err})
+				partial = true
+			}
+		}
+		patch.WriteString(result.patch)
+		if opts.summaryJSON {
+			files = append(files, newJSONResult(job.filename, result, opts))
+			total += replacements(result)
+			continue
+		}
+		if err := reportResult(out, job.filename, result, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON output: %v\n", err)
+			return 1
+		}
+	}
+
+	if opts.summaryJSON {
+		if err := writeJSONSummary(os.Stdout, newJSONSummary(files, total, time.Since(start))); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON output: %v\n", err)
+			return 1
+		}
+	}
+
+	if opts.emitPatch != "" {
+		if err := os.WriteFile(opts.emitPatch, []byte(patch.String()), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing patch: %v\n", err)
+			return 1
+		}
+	}
+
+	if opts.reportUnchanged {
+		summary.write(os.Stderr)
+	}
+	if opts.keepGoing {
+		writeFailureReport(os.Stderr, failures)
+	}
+	if len(summary.failed) > 0 {
+		return 1
+	}
+	if partial {
+		return exitPartial
+	}
+	return 0
+}
+
+// sortJobs orders jobs by file name so that the output of a batch is the same
+// from run to run. The sort is stable, so several edits to the same file are
+// still applied in the order given.
+func sortJobs(jobs []editJob) {
+	slices.SortStableFunc(jobs, func(a, b editJob) int {
+		return strings.Compare(a.filename, b.filename)
+	})
+}
+
+// batchFailure is a file, or one block of it, that could not be edited.
+type batchFailure struct {
+	filename string
+	block    int // 1-based, or 0 when the whole file failed
+	err      error
+}
+
+// writeFailureReport prints every failure of a batch with --keep-going, as
+// the last output so that it is easy to find.
+func writeFailureReport(w io.Writer, failures []batchFailure) {
+	if len(failures) == 0 {
+		return
+	}
+	if len(failures) == 1 {
+		fmt.Fprintf(w, "1 failure:\n")
+	} else {
+		fmt.Fprintf(w, "%d failures:\n", len(failures))
+	}
+	for _, failure := range failures {
+		reason := strings.TrimSuffix(firstLine(failure.err.Error()), ":")
+		if failure.block > 0 {
+			fmt.Fprintf(w, "  %s: block %d: %s\n", failure.filename, failure.block, reason)
+		} else {
+			fmt.Fprintf(w, "  %s: %s\n", failure.filename, reason)
+		}
+	}
+}
+
+// batchSummary tracks the outcome of applying one diff to several files.
+type batchSummary struct {
+	edited    []string
+	unchanged []string
+	failed    []string
+}
+
+// write prints the totals followed by the files that had no match.
+func (s batchSummary) write(w io.Writer) {
+	fmt.Fprintf(w, "%d edited, %d unchanged, %d failed\n", len(s.edited), len(s.unchanged), len(s.failed))
+	for _, filename := range s.unchanged {
+		fmt.Fprintf(w, "  unchanged: %s\n", filename)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortJobs(t *testing.T) {
+	jobs := []editJob{
+		{filename: "b.go", err: errors.New("first")},
+		{filename: "a.go"},
+		{filename: "b.go", err: errors.New("second")},
+		{filename: "A.go"},
+	}
+	sortJobs(jobs)
+
+	var got []string
+	for _, job := range jobs {
+		name := job.filename
+		if job.err != nil {
+			name += " " + job.err.Error()
+		}
+		got = append(got, name)
+	}
+	want := []string{"A.go", "a.go", "b.go first", "b.go second"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortJobs() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteFailureReport(t *testing.T) {
+	failures := []batchFailure{
+		{filename: "a.go", block: 2, err: fmt.Errorf("%w in file:\nfoo", errSearchNotFound)},
+		{filename: "b.go", err: errors.New("reading file b.go: no such file or directory")},
+	}
+
+	var buf strings.Builder
+	writeFailureReport(&buf, failures)
+
+	want := "2 failures:\n" +
+		"  a.go: block 2: search block not found in file\n" +
+		"  b.go: reading file b.go: no such file or directory\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeFailureReport() = %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	writeFailureReport(&buf, failures[1:])
+	if got, want := buf.String(), "1 failure:\n  b.go: reading file b.go: no such file or directory\n"; got != want {
+		t.Errorf("writeFailureReport() = %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	writeFailureReport(&buf, nil)
+	if buf.Len() != 0 {
+		t.Errorf("writeFailureReport(nil) = %q, want nothing", buf.String())
+	}
+}
+
+func TestBatchSummaryWrite(t *testing.T) {
+	summary := batchSummary{
+		edited:    []string{"a.go", "b.go"},
+		unchanged: []string{"c.go"},
+		failed:    []string{"d.go"},
+	}
+
+	var buf strings.Builder
+	summary.write(&buf)
+
+	want := "2 edited, 1 unchanged, 1 failed\n  unchanged: c.go\n"
+	if got := buf.String(); got != want {
+		t.Errorf("write() = %q, want %q", got, want)
+	}
+}
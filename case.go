@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// caseStyle is the capitalization of a piece of text.
+type caseStyle int
+
+const (
+	caseOther caseStyle = iota
+	caseUpper           // ALL CAPS
+	caseTitle           // Every Word Capitalized
+)
+
+// detectCase returns the capitalization of s. Text with a single letter that
+// is upper case counts as title case, since it can't be told apart from ALL
+// CAPS and title case is the more common of the two.
+func detectCase(s string) caseStyle {
+	letters, upper := 0, 0
+	title := true
+	for _, word := range caseWords(s) {
+		for i, r := range word {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+			if (i == 0) != unicode.IsUpper(r) {
+				title = false
+			}
+		}
+	}
+	switch {
+	case letters == 0:
+		return caseOther
+	case upper == letters && letters > 1:
+		return caseUpper
+	case title:
+		return caseTitle
+	}
+	return caseOther
+}
+
+// caseWords splits s into its runs of letters.
+func caseWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })
+}
+
+// matchCase gives replacement the capitalization of matched if that is ALL
+// CAPS or title case, and returns it unchanged otherwise.
+func matchCase(replacement, matched string) string {
+	switch detectCase(matched) {
+	case caseUpper:
+		return strings.ToUpper(replacement)
+	case caseTitle:
+		var b strings.Builder
+		first := true
+		for _, r := range replacement {
+			switch {
+			case !unicode.IsLetter(r):
+				first = true
+			case first:
+				r = unicode.ToUpper(r)
+				first = false
+			default:
+				r = unicode.ToLower(r)
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+	return replacement
+}
+
+// foldCaseView returns a lower-cased view of s, so that search blocks match
+// regardless of capitalization. A letter whose lower case has a different
+// length in UTF-8, such as the Kelvin sign or U+0130, is kept as it is: the
+// view then has the same bytes at the same offsets as s, and a match can't
+// begin or end inside a rune of the original.
+func foldCaseView(s string) view {
+	var builder strings.Builder
+	builder.Grow(len(s))
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if lower := unicode.ToLower(r); r != utf8.RuneError && utf8.RuneLen(lower) == size {
+			builder.WriteRune(lower)
+		} else {
+			builder.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return identityView(builder.String())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMatchCase(t *testing.T) {
+	tests := []struct {
+		name        string
+		replacement string
+		matched     string
+		want        string
+	}{
+		{"all caps", "widget", "GADGET", "WIDGET"},
+		{"title case", "widget", "Gadget", "Widget"},
+		{"title case words", "big widget", "Small Gadget", "Big Widget"},
+		{"title case lowers the rest", "wIDGET", "Gadget", "Widget"},
+		{"single capital", "widget", "G", "Widget"},
+		{"lower case is kept", "Widget", "gadget", "Widget"},
+		{"mixed case is kept", "widget", "gAdget", "widget"},
+		{"camel case is kept", "widget", "myGadget", "widget"},
+		{"no letters", "widget", "42", "widget"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchCase(tt.replacement, tt.matched); got != tt.want {
+				t.Errorf("matchCase(%q, %q) = %q, want %q", tt.replacement, tt.matched, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFoldCaseView(t *testing.T) {
+	s := "Hello \u0130 \u212A \u023A W\u00d6rld \xff"
+	v := foldCaseView(s)
+	if want := "hello \u0130 \u212A \u023A w\u00f6rld \xff"; v.text != want {
+		t.Errorf("foldCaseView() text = %q, want %q", v.text, want)
+	}
+	if len(v.text) != len(s) || v.offsets != nil {
+		t.Errorf("foldCaseView() is not byte for byte: %d bytes for %d, offsets %v", len(v.text), len(s), v.offsets)
+	}
+}
+
+func TestApplyEditPreserveCase(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		replace string
+		want    string
+	}{
+		{"all caps", "const COLOUR = 1\n", "colour", "color", "const COLOR = 1\n"},
+		{"title case", "Colour is nice\n", "colour", "color", "Color is nice\n"},
+		{"lower case", "the colour\n", "Colour", "color", "the color\n"},
+		{"starting on a letter kept as is", "x \u0130STANBUL y\n", "\u0130stanbul", "ankara", "x ANKARA y\n"},
+		{"non-ASCII letters", "x \u00c9T\u00c9 y\n", "\u00e9t\u00e9", "hiver", "x HIVER y\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.search, tt.replace, editOptions{preserveCase: true, wholeWord: true})
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+
+	// Letters whose cases differ in length only match themselves, rather
+	// than splitting a rune
+	for content, search := range map[string]string{
+		"x \u0130stanbul y\n": "istanbul",
+		"x \u212Aelvin y\n":   "kelvin",
+	} {
+		if _, err := applyEdit(content, search, "z", editOptions{preserveCase: true, wholeWord: true}); !errors.Is(err, errSearchNotFound) {
+			t.Errorf("applyEdit(%q, %q) error = %v, want %v", content, search, err, errSearchNotFound)
+		}
+	}
+
+	// Occurrences in any case count, so several of them are ambiguous
+	if _, err := applyEdit("Colour and COLOUR\n", "colour", "color", editOptions{preserveCase: true, wholeWord: true}); err == nil {
+		t.Error("applyEdit() error = nil, want ambiguity error")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// commentSyntax describes how comments and string literals are written in a
+// language, which is all that is needed to find the comments.
+type commentSyntax struct {
+	line       string // starts a comment running to the end of the line
+	blockStart string // starts a comment running to blockEnd
+	blockEnd   string
+	quotes     string // characters that delimit string literals
+}
+
+var (
+	cLikeComments = commentSyntax{line: "//", blockStart: "/*", blockEnd: "*/", quotes: "\"'"}
+	hashComments  = commentSyntax{line: "#", quotes: "\"'"}
+)
+
+// languages maps the --lang names to their comment syntax.
+var languages = map[string]commentSyntax{
+	"c":          cLikeComments,
+	"cpp":        cLikeComments,
+	"go":         {line: "//", blockStart: "/*", blockEnd: "*/", quotes: "\"'`"},
+	"java":       cLikeComments,
+	"javascript": {line: "//", blockStart: "/*", blockEnd: "*/", quotes: "\"'`"},
+	"python":     hashComments,
+	"ruby":       hashComments,
+	"rust":       {line: "//", blockStart: "/*", blockEnd: "*/", quotes: "\""},
+	"shell":      hashComments,
+	"typescript": {line: "//", blockStart: "/*", blockEnd: "*/", quotes: "\"'`"},
+	"yaml":       hashComments,
+}
+
+// lookupLanguage returns the comment syntax for a --lang name.
+func lookupLanguage(name string) (*commentSyntax, error) {
+	syntax, ok := languages[name]
+	if !ok {
+		names := make([]string, 0, len(languages))
+		for name := range languages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown language %q (want one of %s)", name, strings.Join(names, ", "))
+	}
+	return &syntax, nil
+}
+
+// stripComments returns a view of s with its comments removed, along with
+// the whitespace leading up to a comment at the end of a line. Newlines
+// inside block comments are kept so that the view has the same lines as s.
+// Comment markers inside string literals are left alone.
+func stripComments(s string, syntax commentSyntax) view {
+	var text []byte
+	offsets := make([]int, 0, len(s)+1)
+	emit := func(i int) {
+		text = append(text, s[i])
+		offsets = append(offsets, i)
+	}
+	// trimLine drops the blanks just emitted before a comment
+	trimLine := func() {
+		for len(text) > 0 && (text[len(text)-1] == ' ' || text[len(text)-1] == '\t') {
+			text = text[:len(text)-1]
+			offsets = offsets[:len(offsets)-1]
+		}
+	}
+
+	var quote byte
+	for i := 0; i < len(s); {
+		switch {
+		case quote != 0:
+			emit(i)
+			switch s[i] {
+			case '\\':
+				if i+1 < len(s) && s[i+1] != '\n' {
+					i++
+					emit(i)
+				}
+			case quote:
+				quote = 0
+			case '\n':
+				// Only raw strings run over several lines
+				if quote != '`' {
+					quote = 0
+				}
+			}
+			i++
+		case strings.IndexByte(syntax.quotes, s[i]) != -1:
+			quote = s[i]
+			emit(i)
+			i++
+		case syntax.line != "" && strings.HasPrefix(s[i:], syntax.line):
+			trimLine()
+			end := strings.IndexByte(s[i:], '\n')
+			if end == -1 {
+				end = len(s) - i
+			}
+			i += end
+		case syntax.blockStart != "" && strings.HasPrefix(s[i:], syntax.blockStart):
+			trimLine()
+			end := strings.Index(s[i+len(syntax.blockStart):], syntax.blockEnd)
+			if end == -1 {
+				end = len(s)
+			} else {
+				end += i + len(syntax.blockStart) + len(syntax.blockEnd)
+			}
+			for j := i; j < end; j++ {
+				if s[j] == '\n' {
+					emit(j)
+				}
+			}
+			i = end
+		default:
+			emit(i)
+			i++
+		}
+	}
+	offsets = append(offsets, len(s))
+
+	return view{text: string(text), offsets: offsets}
+}
+
+// composeViews returns the view of the original text of outer that inner,
+// a view of outer's text, presents.
+func composeViews(outer, inner view) view {
+	switch {
+	case outer.offsets == nil:
+		return inner
+	case inner.offsets == nil:
+		return outer
+	}
+	offsets := slices.Clone(inner.offsets)
+	for i, offset := range offsets {
+		offsets[i] = outer.offsets[offset]
+	}
+	return view{text: inner.text, offsets: offsets}
+}
@@ -0,0 +1,116 @@
+package main
+
+import "testing"
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name  string
+		lang  string
+		input string
+		want  string
+	}{
+		{"line comment", "go", "x := 1 // one\ny := 2\n", "x := 1\ny := 2\n"},
+		{"whole line comment", "go", "// note\nx := 1\n", "\nx := 1\n"},
+		{"block comment", "c", "a /* b\nc */ d\n", "a\n d\n"},
+		{"unterminated block", "c", "a /* b\nc", "a\n"},
+		{"marker in string", "go", "s := \"http://x\" // url\n", "s := \"http://x\"\n"},
+		{"escaped quote", "go", "s := \"a\\\"//\" // c\n", "s := \"a\\\"//\"\n"},
+		{"raw string", "go", "s := `a\n// b`\n", "s := `a\n// b`\n"},
+		{"hash comment", "python", "x = 1  # one\ns = '#'\n", "x = 1\ns = '#'\n"},
+		{"unterminated quote ends at line", "python", "x = \"a\n# c\n", "x = \"a\n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			syntax, err := lookupLanguage(tt.lang)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := stripComments(tt.input, *syntax)
+			if v.text != tt.want {
+				t.Errorf("stripComments() = %q, want %q", v.text, tt.want)
+			}
+			if len(v.offsets) != len(v.text)+1 {
+				t.Fatalf("len(offsets) = %d, want %d", len(v.offsets), len(v.text)+1)
+			}
+			for i := range len(v.text) {
+				if tt.input[v.offsets[i]] != v.text[i] {
+					t.Errorf("offsets[%d] = %d maps %q to %q", i, v.offsets[i], v.text[i], tt.input[v.offsets[i]])
+				}
+			}
+		})
+	}
+}
+
+func TestApplyEditIgnoreComments(t *testing.T) {
+	goSyntax, err := lookupLanguage("go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		replace string
+		opts    editOptions
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "changed comment",
+			content: "func f() {\n\tx := 1 // the answer\n\treturn x\n}\n",
+			search:  "\tx := 1 // an answer\n\treturn x\n",
+			replace: "\tx := 42 // the answer\n\treturn x\n",
+			opts:    editOptions{comments: goSyntax},
+			want:    "func f() {\n\tx := 42 // the answer\n\treturn x\n}\n",
+		},
+		{
+			name:    "comment missing from search",
+			content: "a := 1 /* one */\nb := 2\n",
+			search:  "a := 1\nb := 2",
+			replace: "a := 3\nb := 4",
+			opts:    editOptions{comments: goSyntax},
+			want:    "a := 3\nb := 4\n",
+		},
+		{
+			name:    "combined with equivalent indent",
+			content: "\tx := 1 // one\n",
+			search:  "    x := 1\n",
+			replace: "\tx := 2\n",
+			opts:    editOptions{comments: goSyntax, equivalentIndent: true},
+			want:    "\tx := 2\n",
+		},
+		{
+			name:    "off by default",
+			content: "x := 1 // one\n",
+			search:  "x := 1 // uno\n",
+			replace: "x := 2\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.search, tt.replace, tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("applyEdit() = %q, want error", result.content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupLanguage(t *testing.T) {
+	if _, err := lookupLanguage("cobol"); err == nil {
+		t.Error("lookupLanguage(\"cobol\") error = nil, want error")
+	}
+}
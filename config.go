@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+)
+
+// defaultConfigFile is the config file read from the working directory when
+// --config isn't given.
+const defaultConfigFile = ".apply-edit.json"
+
+// commandOptions are the options that run shell commands. A config file is
+// picked up from whatever directory the tool runs in, so it may not set them:
+// running in an untrusted checkout must not run its commands.
+var commandOptions = []string{"files-from-cmd", "format-cmd"}
+
+// configPath returns the config file named with --config in args, or the
+// default one. explicit reports whether it was named, in which case it must
+// exist. An empty --config means no config file at all.
+func configPath(flags *flag.FlagSet, args []string) (path string, explicit bool) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "-" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name == "config" {
+			if !hasValue && i+1 < len(args) {
+				value = args[i+1]
+			}
+			return value, true
+		}
+		if f := flags.Lookup(name); f != nil && !hasValue {
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+				// Skip this flag's value
+				i++
+			}
+		}
+	}
+	return defaultConfigFile, false
+}
+
+// loadConfig sets flags from the JSON object in the config file at path, which
+// maps flag names to values, e.g. {"backup": true, "context-lines": 5}. It
+// must be called before the command line is parsed so that flags given there
+// override the config. A missing file is only an error if required.
+func loadConfig(flags *flag.FlagSet, path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for name, value := range values {
+		if name == "config" || flags.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+		if slices.Contains(commandOptions, name) {
+			return fmt.Errorf("%s: option %q runs a command and can only be given on the command line", path, name)
+		}
+		var text string
+		switch v := value.(type) {
+		case string:
+			text = v
+		case bool, float64:
+			text = fmt.Sprint(v)
+		default:
+			return fmt.Errorf("%s: option %q must be a string, number or boolean", path, name)
+		}
+		if err := flags.Set(name, text); err != nil {
+			return fmt.Errorf("%s: option %q: %w", path, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigPath(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.String("diff", "", "")
+	flags.Bool("backup", false, "")
+
+	tests := []struct {
+		name         string
+		args         []string
+		want         string
+		wantExplicit bool
+	}{
+		{"default", []string{"--backup", "file.txt"}, defaultConfigFile, false},
+		{"separate value", []string{"--backup", "--config", "team.json", "file.txt"}, "team.json", true},
+		{"joined value", []string{"-config=team.json"}, "team.json", true},
+		{"disabled", []string{"--config="}, "", true},
+		{"value of another flag", []string{"--diff", "--config", "file.txt"}, defaultConfigFile, false},
+		{"after the file names", []string{"file.txt", "--config", "team.json"}, defaultConfigFile, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, explicit := configPath(flags, tt.args)
+			if got != tt.want || explicit != tt.wantExplicit {
+				t.Errorf("configPath(%q) = %q, %v, want %q, %v", tt.args, got, explicit, tt.want, tt.wantExplicit)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	newFlags := func() (*flag.FlagSet, *bool, *int, *string) {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		backup := flags.Bool("backup", false, "")
+		lines := flags.Int("context-lines", 3, "")
+		lang := flags.String("lang", "", "")
+		flags.String("format-cmd", "", "")
+		return flags, backup, lines, lang
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"backup": true, "context-lines": 5, "lang": "go"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	flags, backup, lines, lang := newFlags()
+	if err := loadConfig(flags, path, true); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if err := flags.Parse([]string{"--context-lines", "7"}); err != nil {
+		t.Fatal(err)
+	}
+	if !*backup || *lines != 7 || *lang != "go" {
+		t.Errorf("flags = %v, %d, %q, want the config values with the command line overriding context-lines", *backup, *lines, *lang)
+	}
+
+	flags, _, _, _ = newFlags()
+	if err := loadConfig(flags, filepath.Join(dir, "missing.json"), false); err != nil {
+		t.Errorf("loadConfig() of a missing default file error = %v", err)
+	}
+	if err := loadConfig(flags, filepath.Join(dir, "missing.json"), true); err == nil {
+		t.Error("loadConfig() of a missing --config file succeeded, want an error")
+	}
+
+	for name, content := range map[string]string{
+		"unknown option": `{"no-such-flag": true}`,
+		"invalid value":  `{"context-lines": "many"}`,
+		"nested value":   `{"lang": ["go"]}`,
+		"not an object":  `[]`,
+		"command option": `{"format-cmd": "touch PWNED"}`,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		flags, _, _, _ = newFlags()
+		if err := loadConfig(flags, path, true); err == nil {
+			t.Errorf("loadConfig() with %s succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// blockPrompt asks whether to apply each block of a diff, for --confirm-each.
+// The answers are read from the terminal, since stdin usually carries the
+// diff.
+type blockPrompt struct {
+	in           *bufio.Reader
+	out          io.Writer
+	contextLines int
+	// filename is the file being edited, named in the previews.
+	filename string
+}
+
+func newBlockPrompt(contextLines int) (*blockPrompt, error) {
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONIN$"
+	}
+	tty, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &blockPrompt{in: bufio.NewReader(tty), out: os.Stderr, contextLines: contextLines}, nil
+}
+
+// confirm shows the change a block makes and asks until it gets a yes or a
+// no.
+func (p *blockPrompt) confirm(block, total int, result editResult) (bool, error) {
+	writePreview(p.out, p.filename, newPreview(result, p.contextLines), false)
+	for {
+		fmt.Fprintf(p.out, "Apply block %d of %d? [y/n] ", block+1, total)
+		answer, err := p.in.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("reading answer: %w", err)
+		}
+	}
+}
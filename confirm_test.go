@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBlockPromptConfirm(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    bool
+		wantErr bool
+	}{
+		{"yes", "y\n", true, false},
+		{"no", "NO\n", false, false},
+		{"asks again", "maybe\n\nyes\n", true, false},
+		{"last line without newline", "n", false, false},
+		{"no answer", "", false, true},
+	}
+
+	result, err := applyEdit("a\nb\nc\n", "b\n", "B\n", editOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			p := &blockPrompt{in: bufio.NewReader(strings.NewReader(tt.input)), out: &out, filename: "f.txt"}
+			got, err := p.confirm(1, 3, result)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("confirm() = %t, %v, want %t, error %t", got, err, tt.want, tt.wantErr)
+			}
+			if !strings.Contains(out.String(), "-b\n+B\n") || !strings.Contains(out.String(), "Apply block 2 of 3? [y/n] ") {
+				t.Errorf("prompt = %q, want the change and the question", out.String())
+			}
+		})
+	}
+}
+
+func TestSearchReplaceBlocksConfirm(t *testing.T) {
+	blocks := []diffBlock{{"one", "1"}, {"two", "2"}, {"three", "3"}}
+	content := "one\ntwo\nthree\n"
+
+	declineSecond := func(block, total int, result editResult) (bool, error) { return block != 1, nil }
+	result, err := searchReplaceBlocksWith(blocks, editOptions{}, false, declineSecond)(context.Background(), content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1\ntwo\n3\n"; result.content != want {
+		t.Errorf("content = %q, want %q", result.content, want)
+	}
+	if got := result.skippedBlocks(); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("skippedBlocks() = %v, want [2]", got)
+	}
+
+	declineAll := func(block, total int, result editResult) (bool, error) { return false, nil }
+	result, err = searchReplaceBlocksWith(blocks, editOptions{}, false, declineAll)(context.Background(), content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.content != content {
+		t.Errorf("declining every block: content = %q, want it unchanged", result.content)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// fileDirective is the prefix of a line naming the file a delimited diff
+// applies to.
+const fileDirective = "file:"
+
+// delimitedJobs splits input into separate diffs on every line that equals
+// delimiter and returns one job per diff and file, in order. A diff whose
+// first non-blank line is "file: PATH" is applied to PATH, resolved against
+// --root; any other diff is applied to each of filenames. A diff that can't be
+// parsed becomes a failed job, and every error names the diff it came from.
+func delimitedJobs(input, delimiter string, filenames []string, opts runOptions) ([]editJob, error) {
+	var jobs []editJob
+	n := 0
+	for _, diff := range splitOnLine(normalize(input), delimiter) {
+		if strings.TrimSpace(diff) == "" {
+			continue
+		}
+		n++
+
+		targets := filenames
+		file, rest, directive := cutFileDirective(diff)
+		if directive {
+			targets = []string{file}
+			diff = rest
+		}
+		if len(targets) == 0 {
+			return nil, fmt.Errorf("diff %d names no file and none were given on the command line", n)
+		}
+
+		edit, err := delimitedEdit(n, diff, opts)
+		for _, filename := range targets {
+			job := editJob{filename: filename, edit: edit, err: err}
+			if directive {
+				if job.filename, err = resolveUnderRoot(opts.root, filename, opts.allowOutside); err != nil {
+					job.filename, job.err = filename, fmt.Errorf("diff %d: %w", n, err)
+				}
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("no diffs found")
+	}
+	return jobs, nil
+}
+
+// delimitedEdit prepares the edit for the n-th diff of a delimited stream.
+func delimitedEdit(n int, diff string, opts runOptions) (editFunc, error) {
+	blocks, err := parseBlocks(diff, opts.parse)
+	if err != nil {
+		return nil, fmt.Errorf("diff %d: parsing diff: %w", n, err)
+	}
+	if opts.lint {
+		writeLintWarnings(os.Stderr, fmt.Sprintf("diff %d: ", n), blocks, opts.minSearchLength)
+	}
+
+	edit, err := blocksEdit(blocks, opts)
+	if err != nil {
+		return nil, fmt.Errorf("diff %d: %w", n, err)
+	}
+	return numberedEdit(n, edit), nil
+}
+
+// splitOnLine splits s on every line that is exactly delimiter, dropping the
+// delimiter lines themselves.
+func splitOnLine(s, delimiter string) []string {
+	var parts []string
+	var current []string
+	for _, line := range strings.Split(s, "\n") {
+		if line == delimiter {
+			parts = append(parts, strings.Join(current, "\n"))
+			current = nil
+			continue
+		}
+		current = append(current, line)
+	}
+	return append(parts, strings.Join(current, "\n"))
+}
+
+// cutFileDirective removes a leading "file: PATH" line from diff and returns
+// the path.
+func cutFileDirective(diff string) (file, rest string, ok bool) {
+	trimmed := strings.TrimLeft(diff, " \t\n")
+	line, rest, _ := strings.Cut(trimmed, "\n")
+	if !strings.HasPrefix(line, fileDirective) {
+		return "", diff, false
+	}
+	file = strings.TrimSpace(strings.TrimPrefix(line, fileDirective))
+	if file == "" {
+		return "", diff, false
+	}
+	return file, rest, true
+}
+
+// numberedEdit wraps edit so that its errors say which diff they came from.
+func numberedEdit(n int, edit editFunc) editFunc {
+	return func(ctx context.Context, content string) (editResult, error) {
+		result, err := edit(ctx, content)
+		if err != nil {
+			return editResult{}, fmt.Errorf("diff %d: %w", n, err)
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDelimitedJobs(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	for _, filename := range []string{a, b} {
+		if err := os.WriteFile(filename, []byte("one\ntwo\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	input := strings.Join([]string{
+		"<<<<<<< SEARCH\none\n=======\n1\n>>>>>>> REPLACE",
+		"file: " + b + "\n<<<<<<< SEARCH\ntwo\n=======\n2\n>>>>>>> REPLACE",
+		"",
+		"not a diff",
+		"<<<<<<< SEARCH\nthree\n=======\n3\n>>>>>>> REPLACE",
+	}, "\n%%\n")
+
+	jobs, err := delimitedJobs(input, "%%", []string{a}, runOptions{})
+	if err != nil {
+		t.Fatalf("delimitedJobs() error = %v", err)
+	}
+	if len(jobs) != 4 {
+		t.Fatalf("got %d jobs, want 4", len(jobs))
+	}
+
+	for i, want := range []string{a, b, a, a} {
+		if jobs[i].filename != want {
+			t.Errorf("jobs[%d].filename = %s, want %s", i, jobs[i].filename, want)
+		}
+	}
+	if jobs[2].err == nil || !strings.Contains(jobs[2].err.Error(), "diff 3") {
+		t.Errorf("jobs[2].err = %v, want a parse error for diff 3", jobs[2].err)
+	}
+
+	for _, job := range jobs[:2] {
+		if _, err := editFile(job.filename, job.edit, runOptions{}); err != nil {
+			t.Fatalf("editFile(%s) error = %v", job.filename, err)
+		}
+	}
+	assertFileContent(t, a, "1\ntwo\n")
+	assertFileContent(t, b, "one\n2\n")
+
+	_, err = editFile(a, jobs[3].edit, runOptions{})
+	if err == nil || !strings.Contains(err.Error(), "diff 4") {
+		t.Errorf("editFile() error = %v, want an error naming diff 4", err)
+	}
+}
+
+func TestDelimitedJobsWithoutFile(t *testing.T) {
+	_, err := delimitedJobs("<<<<<<< SEARCH\na\n=======\nb\n>>>>>>> REPLACE", "%%", nil, runOptions{})
+	if err == nil || !strings.Contains(err.Error(), "names no file") {
+		t.Errorf("delimitedJobs() error = %v, want missing file error", err)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxDiagnoseFuzz is the largest --fuzz that --diagnose tries.
+const maxDiagnoseFuzz = 3
+
+// remedy is one way --diagnose tries to make a failing search block match:
+// either a change of the match options or an edit of the content and search
+// block that keeps line breaks where they are.
+type remedy struct {
+	// fix is what the user can do, such as the option to add.
+	fix     string
+	options func(*editOptions)
+	edit    func(content, search string) (string, string)
+}
+
+// remedies lists the heuristics of --diagnose from the most to the least
+// likely to be what was meant, and so the safest to use.
+var remedies = []remedy{
+	{fix: "--ignore-eol-whitespace", options: func(o *editOptions) { o.ignoreEOLWhitespace = true }},
+	{fix: "--search-trailing-newline auto", options: func(o *editOptions) { o.trailingNewline = trailingNewlineAuto }},
+	{fix: "drop --no-normalize", options: func(o *editOptions) { o.noNormalize = false }},
+	{fix: "fix the line endings, which have lone CRs", edit: func(content, search string) (string, string) {
+		return strings.ReplaceAll(content, "\r", ""), strings.ReplaceAll(search, "\r", "")
+	}},
+	{fix: "remove the final line break of the search block", edit: func(content, search string) (string, string) {
+		return content, strings.TrimSuffix(search, "\n")
+	}},
+	{fix: "--equivalent-indent", options: func(o *editOptions) { o.equivalentIndent = true }},
+	{fix: "--anchor-first-line", options: func(o *editOptions) { o.anchorFirstLine = true }},
+	{fix: "reindent the search block to match the file", edit: func(content, search string) (string, string) {
+		return stripIndentation(content), stripIndentation(search)
+	}},
+	{fix: "--tolerate-blank-lines", options: func(o *editOptions) { o.tolerateBlankLines = true }},
+	{fix: "replace look-alike Unicode characters (quotes, dashes, spaces) in the search block", edit: func(content, search string) (string, string) {
+		return lookalikes.Replace(content), lookalikes.Replace(search)
+	}},
+}
+
+// diagnosis is how a block fares with one remedy.
+type diagnosis struct {
+	fix   string
+	count int
+	line  int // 1-based line of the match when count is 1
+}
+
+// diagnoseBlock tries every remedy on a search block that doesn't apply to
+// content as given, followed by increasing amounts of fuzz if none of them
+// works, and returns the ones that make it match, in order of preference.
+func diagnoseBlock(content, search string, opts editOptions) []diagnosis {
+	var found []diagnosis
+	for _, r := range remedies {
+		tried, triedContent, triedSearch := opts, content, search
+		if r.options != nil {
+			r.options(&tried)
+		} else {
+			triedContent, triedSearch = r.edit(content, search)
+		}
+		if tried == opts && triedContent == content && triedSearch == search {
+			// Nothing to try that wasn't tried as given
+			continue
+		}
+		if count, line := tryMatch(triedContent, triedSearch, tried); count > 0 {
+			found = append(found, diagnosis{r.fix, count, line})
+		}
+	}
+	if len(found) == 0 {
+		found = diagnoseCombined(content, search, opts)
+	}
+	for fuzz := 1; fuzz <= maxDiagnoseFuzz && len(found) == 0; fuzz++ {
+		tried := opts
+		tried.fuzz = fuzz
+		if count, line := tryMatch(content, search, tried); count > 0 {
+			found = append(found, diagnosis{fmt.Sprintf("--fuzz %d (check the result with --dry-run)", fuzz), count, line})
+		}
+	}
+	return found
+}
+
+// diagnoseCombined looks for several remedies that together make search
+// match when none does on its own. Starting from all of them, it leaves out
+// each one that isn't needed.
+func diagnoseCombined(content, search string, opts editOptions) []diagnosis {
+	used := make([]bool, len(remedies))
+	for i := range used {
+		used[i] = true
+	}
+	count, line := tryRemedies(content, search, opts, used)
+	if count == 0 {
+		return nil
+	}
+	for i := range used {
+		used[i] = false
+		if c, l := tryRemedies(content, search, opts, used); c > 0 {
+			count, line = c, l
+		} else {
+			used[i] = true
+		}
+	}
+
+	var fixes []string
+	for i, r := range remedies {
+		if used[i] {
+			fixes = append(fixes, r.fix)
+		}
+	}
+	return []diagnosis{{strings.Join(fixes, " + "), count, line}}
+}
+
+// tryRemedies is tryMatch with the used remedies all applied.
+func tryRemedies(content, search string, opts editOptions, used []bool) (count, line int) {
+	for i, r := range remedies {
+		switch {
+		case !used[i]:
+		case r.options != nil:
+			r.options(&opts)
+		default:
+			content, search = r.edit(content, search)
+		}
+	}
+	return tryMatch(content, search, opts)
+}
+
+// tryMatch reports how many times search matches content with opts, and the
+// line of the match if there is exactly one.
+func tryMatch(content, search string, opts editOptions) (count, line int) {
+	result, err := applyEdit(content, search, "", opts)
+	switch {
+	case err == nil:
+		return 1, strings.Count(result.original[:result.start], "\n") + 1
+	case errors.Is(err, errAmbiguous):
+		var candidates *candidatesError
+		if errors.As(err, &candidates) && len(candidates.lines) > 1 {
+			return len(candidates.lines), 0
+		}
+		return 2, 0
+	}
+	return 0, 0
+}
+
+// stripIndentation removes the leading spaces and tabs of every line.
+func stripIndentation(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimLeft(line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// lookalikes replaces characters that are easily confused with plain ASCII,
+// as introduced by word processors and chat tools, with what they look like.
+var lookalikes = strings.NewReplacer(
+	"\u00a0", " ", "\u2009", " ", "\u202f", " ",
+	"\u2018", "'", "\u2019", "'", "\u201c", "\"", "\u201d", "\"",
+	"\u2013", "-", "\u2014", "-", "\u2212", "-",
+	"\u2026", "...",
+	"\u200b", "", "\u200d", "", "\ufeff", "",
+)
+
+// writeDiagnosis explains for every block of a diff whether it applies to
+// filename and, if not, which remedies would make it apply. The blocks are
+// applied in turn to an in-memory copy as an edit would. It reports false if
+// some block doesn't apply as given. Nothing is written.
+func writeDiagnosis(w io.Writer, filename string, blocks []diffBlock, opts editOptions) (bool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return false, fmt.Errorf("reading file %s: %w", filename, err)
+	}
+
+	fmt.Fprintf(w, "%s:\n", filename)
+	content := normalizeWith(string(data), opts)
+	ok := true
+	for i, block := range blocks {
+		result, err := applyEdit(content, block.search, block.replace, opts)
+		switch {
+		case err == nil:
+			line := strings.Count(result.original[:result.start], "\n") + 1
+			fmt.Fprintf(w, "  block %d: applies as given at line %d\n", i+1, line)
+			content = result.content
+			continue
+		case errors.Is(err, errAmbiguous):
+			count, _ := tryMatch(content, block.search, opts)
+			fmt.Fprintf(w, "  block %d: matches %d times; add --context-before, --context-after or --occurrence-hash (see --match-report)\n", i+1, count)
+		case errors.Is(err, errSearchNotFound):
+			fmt.Fprintf(w, "  block %d: not found as given\n", i+1)
+			writeRemedies(w, diagnoseBlock(content, normalizeWith(block.search, opts), opts))
+		default:
+			fmt.Fprintf(w, "  block %d: %s\n", i+1, firstLine(err.Error()))
+		}
+		ok = false
+	}
+	return ok, nil
+}
+
+// writeRemedies prints the remedies that make a block match, numbered by
+// preference.
+func writeRemedies(w io.Writer, found []diagnosis) {
+	if len(found) == 0 {
+		fmt.Fprintf(w, "    no heuristic makes it match; check that the search block is from the current version of the file\n")
+		return
+	}
+	for i, d := range found {
+		if d.count == 1 {
+			fmt.Fprintf(w, "    %d. %s: matches at line %d\n", i+1, d.fix, d.line)
+		} else {
+			fmt.Fprintf(w, "    %d. %s: matches %d times, so it also needs more context\n", i+1, d.fix, d.count)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiagnoseBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		want    string
+	}{
+		{
+			name:    "trailing whitespace",
+			content: "a\nx = 1  \nb\n",
+			search:  "x = 1\nb",
+			want:    "--ignore-eol-whitespace@2",
+		},
+		{
+			name:    "tabs for spaces",
+			content: "if x:\n\ty = 1\n\tz = 2\n",
+			search:  "    y = 1\n    z = 2",
+			want:    "--equivalent-indent@2,reindent the search block to match the file@2",
+		},
+		{
+			name:    "smart quotes",
+			content: "say(\"hi\")\n",
+			search:  "say(“hi”)",
+			want:    "replace look-alike Unicode characters (quotes, dashes, spaces) in the search block@1",
+		},
+		{
+			name:    "several differences at once",
+			content: "x = 1  \n\ty = \"a\"\n",
+			search:  "x = 1\n  y = “a”",
+			want:    "--ignore-eol-whitespace + reindent the search block to match the file + replace look-alike Unicode characters (quotes, dashes, spaces) in the search block@1",
+		},
+		{
+			name:    "fuzz as a last resort",
+			content: "one\ntwo\nthree\n",
+			search:  "one\n2\nthree",
+			want:    "--fuzz 1 (check the result with --dry-run)@1",
+		},
+		{
+			name:    "nothing helps",
+			content: "one\ntwo\n",
+			search:  "three\nfour\nfive",
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range diagnoseBlock(tt.content, tt.search, editOptions{}) {
+				got = append(got, fmt.Sprintf("%s@%d", d.fix, d.line))
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("diagnoseBlock() = %q, want %q", strings.Join(got, ","), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteDiagnosis(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.py")
+	if err := os.WriteFile(filename, []byte("x = 1  \ny = 2\ny = 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	blocks := []diffBlock{{"x = 1\n", "x = 0\n"}, {"y = 2", "y = 3"}}
+
+	var buf strings.Builder
+	ok, err := writeDiagnosis(&buf, filename, blocks, editOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("writeDiagnosis() = true, want false for failing blocks")
+	}
+	want := filename + ":\n" +
+		"  block 1: not found as given\n" +
+		"    1. --ignore-eol-whitespace: matches at line 1\n" +
+		"    2. remove the final line break of the search block: matches at line 1\n" +
+		"  block 2: matches 2 times; add --context-before, --context-after or --occurrence-hash (see --match-report)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeDiagnosis() = %q, want %q", got, want)
+	}
+}
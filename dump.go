@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeParseDump prints the parsed blocks of a diff with their whitespace made
+// visible: tabs as →, trailing spaces as ·, carriage returns as ␍ and the end
+// of every line as ¶. Each line is numbered within its block.
+func writeParseDump(w io.Writer, blocks []diffBlock) {
+	for i, block := range blocks {
+		writeDumpBlock(w, fmt.Sprintf("block %d search", i+1), block.search)
+		writeDumpBlock(w, fmt.Sprintf("block %d replace", i+1), block.replace)
+	}
+}
+
+func writeDumpBlock(w io.Writer, title, block string) {
+	if block == "" {
+		fmt.Fprintf(w, "%s: (empty)\n", title)
+		return
+	}
+
+	lines := strings.Split(block, "\n")
+	if len(lines) == 1 {
+		fmt.Fprintf(w, "%s: 1 line\n", title)
+	} else {
+		fmt.Fprintf(w, "%s: %d lines\n", title, len(lines))
+	}
+	width := len(fmt.Sprint(len(lines)))
+	for i, line := range lines {
+		fmt.Fprintf(w, "  %*d | %s¶\n", width, i+1, visibleWhitespace(line))
+	}
+}
+
+// visibleWhitespace replaces the whitespace of line that is hard to see with
+// visible symbols.
+func visibleWhitespace(line string) string {
+	body := strings.TrimRight(line, " \t\r")
+	trailing := line[len(body):]
+
+	r := strings.NewReplacer("\t", "→", "\r", "␍")
+	return r.Replace(body) + strings.NewReplacer("\t", "→", "\r", "␍", " ", "·").Replace(trailing)
+}
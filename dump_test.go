@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVisibleWhitespace(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"plain text", "plain text"},
+		{"\tindented", "→indented"},
+		{"trailing  ", "trailing··"},
+		{"mixed \t", "mixed·→"},
+		{"crlf\r", "crlf␍"},
+		{"   ", "···"},
+	}
+
+	for _, tt := range tests {
+		if got := visibleWhitespace(tt.line); got != tt.want {
+			t.Errorf("visibleWhitespace(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestWriteParseDump(t *testing.T) {
+	var buf strings.Builder
+	writeParseDump(&buf, []diffBlock{{search: "def f():\n\treturn ", replace: ""}})
+
+	want := "block 1 search: 2 lines\n" +
+		"  1 | def f():¶\n" +
+		"  2 | →return·¶\n" +
+		"block 1 replace: (empty)\n"
+	if buf.String() != want {
+		t.Errorf("writeParseDump() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+)
+
+// textEncoding is a file encoding that --detect-encoding can read and write.
+// Text is always edited as UTF-8 and converted back when written.
+type textEncoding int
+
+const (
+	encodingUTF8 textEncoding = iota
+	encodingUTF16LE
+	encodingUTF16BE
+)
+
+func (e textEncoding) String() string {
+	switch e {
+	case encodingUTF16LE:
+		return "UTF-16LE"
+	case encodingUTF16BE:
+		return "UTF-16BE"
+	default:
+		return "UTF-8"
+	}
+}
+
+// detectEncoding guesses the encoding of data from its byte order mark or,
+// without one, from where NUL bytes appear: ASCII text in UTF-16 has a NUL in
+// every other byte. Anything inconclusive is treated as UTF-8.
+func detectEncoding(data []byte) textEncoding {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return encodingUTF16LE
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return encodingUTF16BE
+	}
+
+	sample := data[:min(len(data), 8000)]
+	if len(sample) < 2 || len(sample)%2 != 0 {
+		return encodingUTF8
+	}
+	var even, odd int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			even++
+		} else {
+			odd++
+		}
+	}
+	units := len(sample) / 2
+	switch {
+	case odd > units/2 && even == 0:
+		return encodingUTF16LE
+	case even > units/2 && odd == 0:
+		return encodingUTF16BE
+	}
+	return encodingUTF8
+}
+
+func (e textEncoding) byteOrder() binary.ByteOrder {
+	if e == encodingUTF16BE {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// decode converts data in encoding e to UTF-8. A byte order mark is kept as
+// U+FEFF so that it is written back. Data that would not survive a round
+// trip, such as unpaired surrogates, is an error.
+func (e textEncoding) decode(data []byte) (string, error) {
+	if e == encodingUTF8 {
+		return string(data), nil
+	}
+	if len(data)%2 != 0 {
+		return "", errors.New("odd number of bytes in " + e.String() + " text")
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = e.byteOrder().Uint16(data[2*i:])
+	}
+	text := string(utf16.Decode(units))
+	if !bytes.Equal(e.encode(text), data) {
+		return "", errors.New("invalid " + e.String() + " text")
+	}
+	return text, nil
+}
+
+// encode converts UTF-8 text to encoding e.
+func (e textEncoding) encode(text string) []byte {
+	if e == encodingUTF8 {
+		return []byte(text)
+	}
+	units := utf16.Encode([]rune(text))
+	data := make([]byte, 2*len(units))
+	for i, unit := range units {
+		e.byteOrder().PutUint16(data[2*i:], unit)
+	}
+	return data
+}
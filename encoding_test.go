@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want textEncoding
+	}{
+		{"utf8", []byte("héllo\n"), encodingUTF8},
+		{"utf8_bom", []byte("\xEF\xBB\xBFhi\n"), encodingUTF8},
+		{"utf16le_bom", []byte{0xFF, 0xFE, 'h', 0, 'i', 0}, encodingUTF16LE},
+		{"utf16be_bom", []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, encodingUTF16BE},
+		{"utf16le_without_bom", []byte{'h', 0, 'i', 0, '\n', 0}, encodingUTF16LE},
+		{"utf16be_without_bom", []byte{0, 'h', 0, 'i', 0, '\n'}, encodingUTF16BE},
+		{"binary", []byte{0, 0, 1, 0, 0, 2}, encodingUTF8},
+		{"empty", nil, encodingUTF8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectEncoding(tt.data); got != tt.want {
+				t.Errorf("detectEncoding() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	for _, enc := range []textEncoding{encodingUTF8, encodingUTF16LE, encodingUTF16BE} {
+		text := "\uFEFFnaïve 🙂\r\n"
+		got, err := enc.decode(enc.encode(text))
+		if err != nil {
+			t.Fatalf("%s: decode() error = %v", enc, err)
+		}
+		if got != text {
+			t.Errorf("%s: round trip = %q, want %q", enc, got, text)
+		}
+	}
+
+	if _, err := encodingUTF16LE.decode([]byte{0x00, 0xD8, 'a', 0}); err == nil {
+		t.Error("decode() of an unpaired surrogate succeeded")
+	}
+}
+
+func TestEditFileDetectEncoding(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(filename, encodingUTF16LE.encode("\uFEFFname = old\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	edit := searchReplace("old", "new", editOptions{})
+	if _, err := editFile(filename, edit, runOptions{}); err == nil {
+		t.Fatal("editFile() of UTF-16 without --detect-encoding succeeded, want binary file error")
+	}
+	if _, err := editFile(filename, edit, runOptions{detectEncoding: true}); err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	assertFileContent(t, filename, string(encodingUTF16LE.encode("\uFEFFname = new\r\n")))
+}
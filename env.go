@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// expandEnv replaces every ${NAME} in s with the value lookup returns for
+// NAME, and $$ with a literal $. A $ followed by anything else is kept as is.
+// An unset variable is an error unless allowUnset is set, in which case it
+// expands to the empty string.
+func expandEnv(s string, lookup func(string) (string, bool), allowUnset bool) (string, error) {
+	var builder strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i == -1 || i == len(s)-1 {
+			builder.WriteString(s)
+			return builder.String(), nil
+		}
+		builder.WriteString(s[:i])
+
+		switch s[i+1] {
+		case '$':
+			builder.WriteByte('$')
+			s = s[i+2:]
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end == -1 {
+				return "", fmt.Errorf("unterminated variable reference %q", firstLine(s[i:]))
+			}
+			name := s[i+2 : i+end]
+			if !isEnvName(name) {
+				return "", fmt.Errorf("invalid variable reference %q (write $${ for a literal ${)", s[i:i+end+1])
+			}
+			value, ok := lookup(name)
+			if !ok && !allowUnset {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			builder.WriteString(value)
+			s = s[i+end+1:]
+		default:
+			builder.WriteByte('$')
+			s = s[i+1:]
+		}
+	}
+}
+
+// isEnvName reports whether name is a valid environment variable name for
+// ${NAME}: a letter or underscore followed by letters, digits and
+// underscores.
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
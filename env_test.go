@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{"VERSION": "1.2.3", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		allowUnset bool
+		want       string
+		wantErr    string
+	}{
+		{name: "no_references", input: "plain text", want: "plain text"},
+		{name: "variable", input: "version = \"${VERSION}\"", want: "version = \"1.2.3\""},
+		{name: "set_but_empty", input: "[${EMPTY}]", want: "[]"},
+		{name: "escaped_dollar", input: "cost: $$5, $${VERSION}", want: "cost: $5, ${VERSION}"},
+		{name: "bare_dollar_kept", input: "echo $HOME $", want: "echo $HOME $"},
+		{name: "unset", input: "${MISSING}", wantErr: "MISSING is not set"},
+		{name: "unset_allowed", input: "a${MISSING}b", allowUnset: true, want: "ab"},
+		{name: "invalid_name", input: "`${a + b}`", wantErr: "invalid variable reference"},
+		{name: "unterminated", input: "${VERSION\nnext", wantErr: "unterminated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandEnv(tt.input, lookup, tt.allowUnset)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expandEnv() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandEnv() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expandEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
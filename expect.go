@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// checkExpectedOutput compares the content an edit produced against the
+// golden file at path. When they differ, the error carries a hunk showing how
+// the output strays from the expected content.
+func checkExpectedOutput(path string, output []byte) error {
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading expected output: %w", err)
+	}
+	if bytes.Equal(output, expected) {
+		return nil
+	}
+
+	var hunk strings.Builder
+	writePreview(&hunk, path, outputPreview(string(expected), string(output), defaultContextLines), false)
+	return fmt.Errorf("output differs from %s:\n%s", path, strings.TrimSuffix(hunk.String(), "\n"))
+}
+
+// outputPreview is the region where actual differs from expected, from the
+// first differing line to the last, as a preview of turning one into the
+// other.
+func outputPreview(expected, actual string, contextLines int) preview {
+	expectedLines, actualLines := patchLines(expected), patchLines(actual)
+	prefix, suffix := sharedEnds(expectedLines, actualLines)
+
+	leading := expectedLines[max(0, prefix-contextLines):prefix]
+	trailing := expectedLines[len(expectedLines)-suffix:]
+	trailing = trailing[:min(len(trailing), contextLines)]
+	return preview{
+		matchLine: prefix + 1,
+		before:    trimLines(expectedLines[prefix : len(expectedLines)-suffix]),
+		after:     trimLines(actualLines[prefix : len(actualLines)-suffix]),
+		context:   [2][]string{trimLines(leading), trimLines(trailing)},
+	}
+}
+
+// trimLines drops the line terminators kept by patchLines.
+func trimLines(lines []string) []string {
+	var trimmed []string
+	for _, line := range lines {
+		trimmed = append(trimmed, strings.TrimSuffix(line, "\n"))
+	}
+	return trimmed
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOutputPreview(t *testing.T) {
+	tests := []struct {
+		name         string
+		expected     string
+		actual       string
+		wantLine     int
+		wantBefore   []string
+		wantAfter    []string
+		wantLeading  []string
+		wantTrailing []string
+	}{
+		{
+			name:         "changed line",
+			expected:     "a\nb\nc\nd\ne\n",
+			actual:       "a\nb\nC\nd\ne\n",
+			wantLine:     3,
+			wantBefore:   []string{"c"},
+			wantAfter:    []string{"C"},
+			wantLeading:  []string{"a", "b"},
+			wantTrailing: []string{"d", "e"},
+		},
+		{
+			name:         "two separate changes",
+			expected:     "a\nb\nc\n",
+			actual:       "A\nb\nC\n",
+			wantLine:     1,
+			wantBefore:   []string{"a", "b", "c"},
+			wantAfter:    []string{"A", "b", "C"},
+			wantLeading:  nil,
+			wantTrailing: nil,
+		},
+		{
+			name:         "added line",
+			expected:     "a\nc\n",
+			actual:       "a\nb\nc\n",
+			wantLine:     2,
+			wantBefore:   nil,
+			wantAfter:    []string{"b"},
+			wantLeading:  []string{"a"},
+			wantTrailing: []string{"c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := outputPreview(tt.expected, tt.actual, 2)
+			if p.matchLine != tt.wantLine {
+				t.Errorf("matchLine = %d, want %d", p.matchLine, tt.wantLine)
+			}
+			if !reflect.DeepEqual(p.before, tt.wantBefore) || !reflect.DeepEqual(p.after, tt.wantAfter) {
+				t.Errorf("before, after = %q, %q, want %q, %q", p.before, p.after, tt.wantBefore, tt.wantAfter)
+			}
+			if !reflect.DeepEqual(p.context[0], tt.wantLeading) || !reflect.DeepEqual(p.context[1], tt.wantTrailing) {
+				t.Errorf("context = %q, want %q, %q", p.context, tt.wantLeading, tt.wantTrailing)
+			}
+		})
+	}
+}
+
+func TestExpectOutput(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.py")
+	golden := filepath.Join(dir, "app.py.golden")
+	if err := os.WriteFile(file, []byte("x = 1\ny = 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(golden, []byte("x = 10\ny = 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := runOptions{dryRun: true, expectOutput: golden}
+
+	if _, err := editFile(file, searchReplace("x = 1", "x = 10", opts.edit), opts); err != nil {
+		t.Errorf("matching output: editFile() error = %v", err)
+	}
+
+	_, err := editFile(file, searchReplace("x = 1", "x = 11", opts.edit), opts)
+	if err == nil || !strings.Contains(err.Error(), "-x = 10\n+x = 11") {
+		t.Errorf("differing output: editFile() error = %v, want the differing lines", err)
+	}
+
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "x = 1\ny = 2\n" {
+		t.Errorf("file content = %q, want it untouched", got)
+	}
+}
@@ -0,0 +1,68 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestEditFileNamedPipe(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "pipe")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The other end of the pipe: feed the content in, then read the result
+	output := make(chan string)
+	go func() {
+		defer close(output)
+		if err := os.WriteFile(fifo, []byte("hello world\n"), 0644); err != nil {
+			t.Error(err)
+			return
+		}
+		f, err := os.Open(fifo)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			t.Error(err)
+		}
+		output <- string(data)
+	}()
+
+	_, err := editFile(fifo, searchReplace("world", "pipe", editOptions{}), runOptions{atomic: true, lock: true})
+	if err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	if got := <-output; got != "hello pipe\n" {
+		t.Errorf("pipe output = %q, want %q", got, "hello pipe\n")
+	}
+	if info, err := os.Lstat(fifo); err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		t.Errorf("pipe was replaced, mode = %v, err = %v", info.Mode(), err)
+	}
+}
+
+func TestEditFileNotRegular(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{os.DevNull, "is a device"},
+		{t.TempDir(), "is a directory"},
+	}
+
+	for _, tt := range tests {
+		_, err := editFile(tt.filename, searchReplace("a", "b", editOptions{}), runOptions{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("editFile(%s) error = %v, want it to say it %s", tt.filename, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// filesFromCommand runs command with the system shell and returns the files
+// it lists on stdout. The list is NUL-separated if the output contains a NUL,
+// as with git ls-files -z or rg -l0, and newline-separated otherwise.
+func filesFromCommand(command string) ([]string, error) {
+	cmd := shellCommand(command)
+	// The diff may be on our stdin, which the command must not consume
+	cmd.Stdin = nil
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running %q: %w", command, err)
+	}
+	return splitFileList(out), nil
+}
+
+// shellCommand returns the command to run command with the system shell.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// shellQuote quotes s as a single word for the system shell.
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + s + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// splitFileList splits the output of a file listing command into file names,
+// dropping empty entries.
+func splitFileList(out []byte) []string {
+	var names []string
+	if bytes.IndexByte(out, 0) != -1 {
+		names = strings.Split(string(out), "\x00")
+	} else {
+		names = strings.Split(normalize(string(out)), "\n")
+	}
+
+	files := names[:0]
+	for _, name := range names {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+	return files
+}
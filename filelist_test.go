@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestSplitFileList(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want []string
+	}{
+		{"newlines", "a.go\nb c.go\n", []string{"a.go", "b c.go"}},
+		{"crlf", "a.go\r\nb.go\r\n", []string{"a.go", "b.go"}},
+		{"nul", "a.go\x00new\nline.go\x00", []string{"a.go", "new\nline.go"}},
+		{"empty", "", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitFileList([]byte(tt.out)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitFileList() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilesFromCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+
+	got, err := filesFromCommand(`printf 'a b.txt\0c.txt\0'`)
+	if err != nil {
+		t.Fatalf("filesFromCommand() error = %v", err)
+	}
+	if want := []string{"a b.txt", "c.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("filesFromCommand() = %q, want %q", got, want)
+	}
+
+	if _, err := filesFromCommand("exit 3"); err == nil {
+		t.Error("filesFromCommand() with failing command error = nil, want error")
+	}
+}
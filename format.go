@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runFormatter runs the --format-cmd command on filename. Every {} in the
+// command is replaced by the quoted file name, which is appended when there
+// is none. The formatter's output goes to stderr to keep stdout for results.
+func runFormatter(command, filename string) error {
+	quoted := shellQuote(filename)
+	if strings.Contains(command, "{}") {
+		command = strings.ReplaceAll(command, "{}", quoted)
+	} else {
+		command += " " + quoted
+	}
+
+	cmd := shellCommand(command)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %q: %w", command, err)
+	}
+	return nil
+}
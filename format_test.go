@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestEditFileFormatCmd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+
+	tests := []struct {
+		name    string
+		opts    runOptions
+		want    string
+		wantErr string
+	}{
+		{
+			name: "formatter runs",
+			opts: runOptions{formatCmd: "sed -i.orig 's/  */ /g' {}"},
+			want: "x = 2\n",
+		},
+		{
+			name: "file name appended",
+			opts: runOptions{formatCmd: "sed -i.orig 's/  */ /g'"},
+			want: "x = 2\n",
+		},
+		{
+			name:    "failure keeps the edit",
+			opts:    runOptions{formatCmd: "false"},
+			want:    "x  =  2\n",
+			wantErr: "after the edit was written",
+		},
+		{
+			name:    "failure rolls back",
+			opts:    runOptions{formatCmd: "false", formatRollback: true},
+			want:    "x  =  1\n",
+			wantErr: "the edit was rolled back",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A quote in the name checks that it is passed to the shell safely
+			filename := filepath.Join(t.TempDir(), "it's.txt")
+			if err := os.WriteFile(filename, []byte("x  =  1\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := editFile(filename, searchReplace("1", "2", editOptions{}), tt.opts)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("editFile() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("editFile() error = %v, want error containing %q", err, tt.wantErr)
+			}
+			assertFileContent(t, filename, tt.want)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+)
+
+// gitModified reports whether filename has uncommitted changes, staged or
+// not, compared to HEAD. ok is false when this can't be determined, e.g.
+// because git is not installed, the file is not in a repository or the
+// repository has no commits yet.
+func gitModified(filename string) (modified, ok bool) {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+
+	// Outside a repository git diff compares files directly instead, so
+	// check for a repository with a HEAD commit first
+	if err := exec.Command("git", "-C", dir, "rev-parse", "--verify", "--quiet", "HEAD").Run(); err != nil {
+		return false, false
+	}
+
+	err := exec.Command("git", "-C", dir, "diff", "--quiet", "HEAD", "--", base).Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return false, true
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return true, true
+	default:
+		return false, false
+	}
+}
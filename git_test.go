@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitModified(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(filename, []byte("committed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := gitModified(filename); ok {
+		t.Fatal("gitModified() outside a repository: ok = true, want false")
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "file.txt"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	if modified, ok := gitModified(filename); !ok || modified {
+		t.Errorf("gitModified() on a clean file = %v, %v, want false, true", modified, ok)
+	}
+
+	if err := os.WriteFile(filename, []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if modified, ok := gitModified(filename); !ok || !modified {
+		t.Errorf("gitModified() on a modified file = %v, %v, want true, true", modified, ok)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// gzipFile is how a gzip-compressed file was written, so that it can be
+// compressed the same way again after the edit.
+type gzipFile struct {
+	header gzip.Header
+	level  int
+}
+
+// isGzipName reports whether filename names a gzip-compressed file.
+func isGzipName(filename string) bool {
+	return strings.HasSuffix(filename, ".gz")
+}
+
+// gunzip decompresses data. The compression level is taken from the extra
+// flags of the gzip header, which only tell the fastest and the best levels
+// apart from the rest.
+func gunzip(data []byte) ([]byte, gzipFile, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, gzipFile{}, err
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, gzipFile{}, err
+	}
+
+	level := gzip.DefaultCompression
+	switch data[8] {
+	case 2:
+		level = gzip.BestCompression
+	case 4:
+		level = gzip.BestSpeed
+	}
+	return plain, gzipFile{header: r.Header, level: level}, nil
+}
+
+// compress compresses data with the header and level of the original file.
+func (g gzipFile) compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, g.level)
+	if err != nil {
+		return nil, err
+	}
+	w.Header = g.header
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func gzipData(t *testing.T, data string, level int, name string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Name = name
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGunzip(t *testing.T) {
+	tests := []struct {
+		name  string
+		level int
+		want  int
+	}{
+		{"best", gzip.BestCompression, gzip.BestCompression},
+		{"fastest", gzip.BestSpeed, gzip.BestSpeed},
+		{"default", gzip.DefaultCompression, gzip.DefaultCompression},
+		{"other levels", 5, gzip.DefaultCompression},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, gz, err := gunzip(gzipData(t, "hello\n", tt.level, "app.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(plain) != "hello\n" || gz.level != tt.want || gz.header.Name != "app.log" {
+				t.Errorf("gunzip() = %q, level %d, name %q, want %q, level %d, name app.log", plain, gz.level, gz.header.Name, "hello\n", tt.want)
+			}
+		})
+	}
+
+	if _, _, err := gunzip([]byte("not compressed")); err == nil {
+		t.Error("gunzip() of plain text: error = nil, want an error")
+	}
+}
+
+func TestEditFileGzip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.gz")
+	original := gzipData(t, "level = debug\nport = 80\n", gzip.BestCompression, "config")
+	if err := os.WriteFile(filename, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := editFile(filename, searchReplace("port = 80", "port = 8080", editOptions{}), runOptions{})
+	if err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	if result.unchanged {
+		t.Fatal("editFile() unchanged = true, want the file edited")
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("edited file is not gzip: %v", err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "level = debug\nport = 8080\n"; string(plain) != want {
+		t.Errorf("decompressed content = %q, want %q", plain, want)
+	}
+	if r.Name != "config" || data[8] != original[8] {
+		t.Errorf("header name %q, extra flags %d, want config, %d", r.Name, data[8], original[8])
+	}
+
+	// A no-op edit leaves the compressed bytes alone
+	if _, err := editFile(filename, searchReplace("level = debug", "level = debug", editOptions{}), runOptions{}); err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	if after, _ := os.ReadFile(filename); !bytes.Equal(after, data) {
+		t.Error("no-op edit rewrote the compressed file")
+	}
+}
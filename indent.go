@@ -0,0 +1,91 @@
+package main
+
+import "strings"
+
+// indentStyle is how a file indents its lines.
+type indentStyle struct {
+	tabs  bool
+	width int // spaces per level when indenting with spaces
+}
+
+// detectIndent returns the predominant indentation style of content. For
+// spaces, the width is the largest step that all indented lines are a
+// multiple of. It reports false when no line is indented.
+func detectIndent(content string) (indentStyle, bool) {
+	tabs, spaces, width := 0, 0, 0
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		switch line[0] {
+		case '\t':
+			tabs++
+		case ' ':
+			spaces++
+			n := len(line) - len(strings.TrimLeft(line, " "))
+			width = gcd(width, n)
+		}
+	}
+	switch {
+	case tabs == 0 && spaces == 0:
+		return indentStyle{}, false
+	case tabs >= spaces:
+		return indentStyle{tabs: true}, true
+	}
+	return indentStyle{width: width}, true
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// reindent rewrites the leading whitespace of every line of text in style.
+// Indenting with tabs, the indentation keeps its column with tab stops every
+// tabWidth columns; indenting with spaces, each tab becomes one level of
+// style.width spaces. With skipFirst, the first line is left alone since it
+// doesn't start a line of the file.
+func reindent(text string, style indentStyle, tabWidth int, skipFirst bool) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		body := strings.TrimLeft(line, " \t")
+		if i == 0 && skipFirst || body == "" {
+			continue
+		}
+		leading := line[:len(line)-len(body)]
+
+		var indent string
+		if style.tabs {
+			column := 0
+			for _, c := range leading {
+				if c == '\t' {
+					column += tabWidth - column%tabWidth
+				} else {
+					column++
+				}
+			}
+			indent = strings.Repeat("\t", column/tabWidth) + strings.Repeat(" ", column%tabWidth)
+		} else {
+			indent = strings.ReplaceAll(leading, "\t", strings.Repeat(" ", style.width))
+		}
+		lines[i] = indent + body
+	}
+	return strings.Join(lines, "\n")
+}
+
+// convertIndent rewrites the indentation of the text an edit inserted to the
+// predominant style of the original content.
+func convertIndent(result editResult, tabWidth int) editResult {
+	style, ok := detectIndent(result.original)
+	if !ok {
+		return result
+	}
+
+	atLineStart := result.start == 0 || result.original[result.start-1] == '\n'
+	replacement := reindent(result.replacement, style, tabWidth, !atLineStart)
+	result.content = result.original[:result.start] + replacement + result.original[result.end:]
+	result.replacement = replacement
+	return result
+}
@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestDetectIndent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    indentStyle
+		wantOK  bool
+	}{
+		{"tabs", "func f() {\n\tif x {\n\t\treturn\n\t}\n}\n", indentStyle{tabs: true}, true},
+		{"two spaces", "a:\n  b:\n    c: 1\n  d: 2\n", indentStyle{width: 2}, true},
+		{"four spaces", "def f():\n    if x:\n        return\n", indentStyle{width: 4}, true},
+		{"mostly spaces", "a\n    b\n    c\n\td\n", indentStyle{width: 4}, true},
+		{"not indented", "a\nb\n", indentStyle{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := detectIndent(tt.content)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("detectIndent() = %+v, %t, want %+v, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestConvertIndent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		replace string
+		want    string
+	}{
+		{
+			name:    "spaces to tabs",
+			content: "func f() {\n\treturn\n}\n",
+			search:  "\treturn\n",
+			replace: "    if x {\n        return\n      }\n",
+			want:    "func f() {\n\tif x {\n\t\treturn\n\t  }\n}\n",
+		},
+		{
+			name:    "tabs to spaces",
+			content: "if x:\n  pass\n",
+			search:  "  pass\n",
+			replace: "\tif y:\n\t\tpass\n",
+			want:    "if x:\n  if y:\n    pass\n",
+		},
+		{
+			name:    "mid-line replacement keeps its first line",
+			content: "x = [\n\t1,\n]\n",
+			search:  "1,\n",
+			replace: "1,    \n    2,\n",
+			want:    "x = [\n\t1,    \n\t2,\n]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.search, tt.replace, editOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := convertIndent(result, 4).content; got != tt.want {
+				t.Errorf("convertIndent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
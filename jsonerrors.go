@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Error categories reported with --json-errors. Each one stands for one of
+// the sentinel errors, so that wrappers can branch on it.
+const (
+	categoryNotFound     = "not_found"
+	categoryAmbiguous    = "ambiguous"
+	categoryDeclined     = "declined"
+	categoryStdinTimeout = "stdin_timeout"
+	categoryTimeout      = "timeout"
+	categoryOther        = "error"
+)
+
+// jsonError is an error printed to stderr with --json-errors.
+type jsonError struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Category      string `json:"category"`
+	Message       string `json:"message"`
+	File          string `json:"file,omitempty"`
+	// CandidateLines are the 1-based lines where an ambiguous search block
+	// matched.
+	CandidateLines []int `json:"candidateLines,omitempty"`
+}
+
+// candidatesError is an ambiguity error that knows where the candidate
+// matches are.
+type candidatesError struct {
+	err   error
+	lines []int
+}
+
+func (e *candidatesError) Error() string { return e.err.Error() }
+func (e *candidatesError) Unwrap() error { return e.err }
+
+// withCandidates attaches the lines of matches in content to err.
+func withCandidates(err error, content string, matches []span) error {
+	lines := make([]int, len(matches))
+	for i, m := range matches {
+		lines[i] = strings.Count(content[:m.start], "\n") + 1
+	}
+	return &candidatesError{err, lines}
+}
+
+// errorCategory returns the category of err for --json-errors.
+func errorCategory(err error) string {
+	switch {
+	case errors.Is(err, errSearchNotFound):
+		return categoryNotFound
+	case errors.Is(err, errAmbiguous):
+		return categoryAmbiguous
+	case errors.Is(err, errDeclined):
+		return categoryDeclined
+	case errors.Is(err, errStdinTimeout):
+		return categoryStdinTimeout
+	case errors.Is(err, errMatchTimeout), errors.Is(err, context.DeadlineExceeded):
+		return categoryTimeout
+	}
+	return categoryOther
+}
+
+func newJSONError(filename string, err error) jsonError {
+	e := jsonError{
+		SchemaVersion: jsonSchemaVersion,
+		Category:      errorCategory(err),
+		Message:       err.Error(),
+		File:          filename,
+	}
+	var candidates *candidatesError
+	if errors.As(err, &candidates) {
+		e.CandidateLines = candidates.lines
+	}
+	return e
+}
+
+// reportError prints an error that happened while doing what (e.g. "reading
+// diff"), as JSON with --json-errors and as text otherwise.
+func reportError(w io.Writer, opts runOptions, what string, err error) {
+	if opts.jsonErrors {
+		writeJSONError(w, newJSONError("", fmt.Errorf("%s: %w", what, err)))
+		return
+	}
+	fmt.Fprintf(w, "Error %s: %v\n", what, err)
+}
+
+func writeJSONError(w io.Writer, e jsonError) {
+	encoder := json.NewEncoder(w)
+	encoder.Encode(e)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("performing edit: %w", errSearchNotFound), categoryNotFound},
+		{fmt.Errorf("block 2: %w", errAmbiguous), categoryAmbiguous},
+		{errDeclined, categoryDeclined},
+		{fmt.Errorf("%w after 1s", errStdinTimeout), categoryStdinTimeout},
+		{fmt.Errorf("timed out: %w", context.DeadlineExceeded), categoryTimeout},
+		{fmt.Errorf("performing edit: %w after 1s", errMatchTimeout), categoryTimeout},
+		{errors.New("permission denied"), categoryOther},
+	}
+	for _, tt := range tests {
+		if got := errorCategory(tt.err); got != tt.want {
+			t.Errorf("errorCategory(%q) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestNewJSONErrorCandidates(t *testing.T) {
+	_, err := applyEdit("x\ny\nx\n", "x", "z", editOptions{})
+	var buf bytes.Buffer
+	writeJSONError(&buf, newJSONError("a.txt", fmt.Errorf("performing edit: %w", err)))
+
+	var got jsonError
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Category != categoryAmbiguous || got.File != "a.txt" {
+		t.Errorf("newJSONError() = %+v, want an ambiguous error for a.txt", got)
+	}
+	if want := []int{1, 3}; !reflect.DeepEqual(got.CandidateLines, want) {
+		t.Errorf("newJSONError() candidate lines = %v, want %v", got.CandidateLines, want)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	var buf bytes.Buffer
+	reportError(&buf, runOptions{}, "reading diff", errors.New("boom"))
+	if got, want := buf.String(), "Error reading diff: boom\n"; got != want {
+		t.Errorf("reportError() = %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	reportError(&buf, runOptions{jsonErrors: true}, "reading diff", errors.New("boom"))
+	if got, want := buf.String(), `{"schemaVersion":1,"category":"error","message":"reading diff: boom"}`+"\n"; got != want {
+		t.Errorf("reportError() with --json-errors = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minDistinctiveChars is the number of letters and digits below which a
+// single-line search block is considered too generic to be unique.
+const minDistinctiveChars = 4
+
+// lintDiff checks the parsed blocks of a diff for patterns that usually mean
+// the diff is wrong and returns a warning for each one found. It never
+// prevents the edit. minSearchLength is the --min-search-length threshold, if
+// any.
+func lintDiff(searchBlock, replaceBlock string, minSearchLength int) []string {
+	var warnings []string
+
+	if err := checkSearchLength(searchBlock, minSearchLength); err != nil {
+		warnings = append(warnings, err.Error())
+	}
+
+	trimmed := strings.TrimSpace(searchBlock)
+	if !strings.Contains(trimmed, "\n") && countAlphanumeric(trimmed) < minDistinctiveChars {
+		warnings = append(warnings, "search block is a single generic line and is likely to match more than once or in the wrong place")
+	}
+
+	switch {
+	case replaceBlock == searchBlock:
+		warnings = append(warnings, "replace block is identical to the search block, so the edit changes nothing")
+	case strings.Contains(replaceBlock, searchBlock):
+		warnings = append(warnings, "replace block contains the whole search block; applying the diff again will repeat the change")
+	}
+
+	if line, ok := markerRemnant(searchBlock); ok {
+		warnings = append(warnings, "conflict marker left in the search block: "+line)
+	}
+	if line, ok := markerRemnant(replaceBlock); ok {
+		warnings = append(warnings, "conflict marker left in the replace block: "+line)
+	}
+	return warnings
+}
+
+// writeLintWarnings prints the lint warnings for every block to w, each line
+// starting with prefix.
+func writeLintWarnings(w io.Writer, prefix string, blocks []diffBlock, minSearchLength int) {
+	for _, block := range blocks {
+		for _, warning := range lintDiff(block.search, block.replace, minSearchLength) {
+			fmt.Fprintf(w, "%sWarning: %s\n", prefix, warning)
+		}
+	}
+}
+
+// checkSearchLength fails if the search block, ignoring surrounding
+// whitespace, has fewer than minLength characters. Short blocks are likely to
+// match in more than one place.
+func checkSearchLength(searchBlock string, minLength int) error {
+	n := utf8.RuneCountInString(strings.TrimSpace(searchBlock))
+	if minLength > 0 && n < minLength {
+		return fmt.Errorf("search block has only %d characters, fewer than the minimum of %d; include more surrounding lines", n, minLength)
+	}
+	return nil
+}
+
+// markerRemnant returns the first line of block that looks like a leftover
+// diff or merge conflict marker.
+func markerRemnant(block string) (string, bool) {
+	for _, line := range strings.Split(block, "\n") {
+		if strings.HasPrefix(line, "<<<<<<<") || strings.HasPrefix(line, ">>>>>>>") {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+func countAlphanumeric(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLintDiff(t *testing.T) {
+	tests := []struct {
+		name         string
+		searchBlock  string
+		replaceBlock string
+		// minSearchLength is the --min-search-length threshold
+		minSearchLength int
+		want            []string
+	}{
+		{
+			name:         "replace_extends_search",
+			searchBlock:  "from flask import Flask",
+			replaceBlock: "from flask import Flask, request",
+			want:         []string{"replace block contains the whole search block; applying the diff again will repeat the change"},
+		},
+		{
+			name:         "distinct_replacement",
+			searchBlock:  "func old() {\n}",
+			replaceBlock: "func renamed() {\n}",
+		},
+		{
+			name:         "generic_single_line",
+			searchBlock:  "  }",
+			replaceBlock: "  ]",
+			want:         []string{"search block is a single generic line and is likely to match more than once or in the wrong place"},
+		},
+		{
+			name:         "short_lines_in_block",
+			searchBlock:  "}\n}",
+			replaceBlock: "]\n}",
+		},
+		{
+			name:         "identical",
+			searchBlock:  "return value",
+			replaceBlock: "return value",
+			want:         []string{"replace block is identical to the search block, so the edit changes nothing"},
+		},
+		{
+			name:         "marker_remnant",
+			searchBlock:  "value := 1",
+			replaceBlock: "<<<<<<< HEAD\nvalue := 2",
+			want:         []string{"conflict marker left in the replace block: <<<<<<< HEAD"},
+		},
+		{
+			name:            "below_min_search_length",
+			searchBlock:     "  x := compute()\n",
+			replaceBlock:    "  x := computeAll()\n",
+			minSearchLength: 20,
+			want:            []string{"search block has only 14 characters, fewer than the minimum of 20; include more surrounding lines"},
+		},
+		{
+			name:            "at_min_search_length",
+			searchBlock:     "x := compute()",
+			replaceBlock:    "x := computeAll()",
+			minSearchLength: 14,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lintDiff(tt.searchBlock, tt.replaceBlock, tt.minSearchLength); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lintDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
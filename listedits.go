@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxSummaryLength is the longest block summary shown by --list-edits.
+const maxSummaryLength = 50
+
+// writeEditList prints every block of a diff with the size of its search and
+// replace text and a summary of what it searches for.
+func writeEditList(w io.Writer, blocks []diffBlock) {
+	for i, block := range blocks {
+		fmt.Fprintf(w, "block %d: %s -> %s  %s\n", i+1, countLines(block.search), countLines(block.replace), blockSummary(block.search))
+	}
+}
+
+// writeEditMatches prints where each block would apply in filename, applying
+// the blocks in turn to an in-memory copy as an edit would. It reports false
+// if some block doesn't match or is ambiguous. Nothing is written.
+func writeEditMatches(w io.Writer, filename string, blocks []diffBlock, opts editOptions) (bool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return false, fmt.Errorf("reading file %s: %w", filename, err)
+	}
+
+	fmt.Fprintf(w, "%s:\n", filename)
+	content := normalizeWith(string(data), opts)
+	ok := true
+	for i, block := range blocks {
+		var status string
+		result, err := applyEdit(content, block.search, block.replace, opts)
+		switch {
+		case err == nil:
+			first := strings.Count(result.original[:result.start], "\n") + 1
+			last := first + strings.Count(strings.TrimSuffix(result.original[result.start:result.end], "\n"), "\n")
+			status = fmt.Sprintf("lines %d-%d", first, last)
+			content = result.content
+		case errors.Is(err, errAmbiguous):
+			status = "ambiguous"
+			ok = false
+		case errors.Is(err, errSearchNotFound):
+			status = "not found"
+			ok = false
+		default:
+			status = "error: " + firstLine(err.Error())
+			ok = false
+		}
+		fmt.Fprintf(w, "  block %d: %s  %s\n", i+1, status, blockSummary(block.search))
+	}
+	return ok, nil
+}
+
+// blockSummary is the first non-blank line of a block, quoted and shortened
+// to fit on one line.
+func blockSummary(block string) string {
+	summary := ""
+	for _, line := range strings.Split(block, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			summary = line
+			break
+		}
+	}
+	if runes := []rune(summary); len(runes) > maxSummaryLength {
+		summary = string(runes[:maxSummaryLength-1]) + "…"
+	}
+	return fmt.Sprintf("%q", summary)
+}
+
+func countLines(block string) string {
+	switch n := len(splitLines(block)); n {
+	case 0:
+		return "empty"
+	case 1:
+		return "1 line"
+	default:
+		return fmt.Sprintf("%d lines", n)
+	}
+}
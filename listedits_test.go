@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var listEditsBlocks = []diffBlock{
+	{"def hello():\n    print('hi')", "def hello():\n    print('hello')"},
+	{"\n    missing()", ""},
+	{"x = 1", "x = 2"},
+}
+
+func TestWriteEditList(t *testing.T) {
+	var buf strings.Builder
+	writeEditList(&buf, listEditsBlocks)
+
+	want := "block 1: 2 lines -> 2 lines  \"def hello():\"\n" +
+		"block 2: 2 lines -> empty  \"missing()\"\n" +
+		"block 3: 1 line -> 1 line  \"x = 1\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeEditList() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteEditMatches(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.py")
+	content := "x = 1\n\ndef hello():\n    print('hi')\n\nx = 1\n"
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	ok, err := writeEditMatches(&buf, filename, listEditsBlocks, editOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("writeEditMatches() = true, want false")
+	}
+
+	want := filename + ":\n" +
+		"  block 1: lines 3-4  \"def hello():\"\n" +
+		"  block 2: not found  \"missing()\"\n" +
+		"  block 3: ambiguous  \"x = 1\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeEditMatches() = %q, want %q", got, want)
+	}
+	assertFileContent(t, filename, content)
+}
+
+func TestBlockSummary(t *testing.T) {
+	long := strings.Repeat("é", 60)
+	if got, want := blockSummary(long), `"`+strings.Repeat("é", 49)+`…"`; got != want {
+		t.Errorf("blockSummary() = %s, want %s", got, want)
+	}
+	if got := blockSummary(""); got != `""` {
+		t.Errorf("blockSummary(\"\") = %s, want \"\"", got)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func lockFile(filename string) (func() error, error) {
+	return nil, errors.New("file locking is not supported on this platform")
+}
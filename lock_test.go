@@ -0,0 +1,105 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "locked.txt")
+	if err := os.WriteFile(filename, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := lockFile(filename)
+	if err != nil {
+		t.Fatalf("lockFile() error = %v", err)
+	}
+
+	acquired := make(chan func() error)
+	go func() {
+		unlock, err := lockFile(filename)
+		if err != nil {
+			t.Error(err)
+			close(acquired)
+			return
+		}
+		acquired <- unlock
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second lock acquired while the first was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock() error = %v", err)
+	}
+
+	select {
+	case unlock := <-acquired:
+		if unlock != nil {
+			unlock()
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second lock not acquired after the first was released")
+	}
+}
+
+func TestLockFileReplaced(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "locked.txt")
+	if err := os.WriteFile(filename, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := lockFile(filename)
+	if err != nil {
+		t.Fatalf("lockFile() error = %v", err)
+	}
+
+	// The waiter opens the original file before it is replaced
+	acquired := make(chan func() error)
+	go func() {
+		unlock, err := lockFile(filename)
+		if err != nil {
+			t.Error(err)
+			close(acquired)
+			return
+		}
+		acquired <- unlock
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := writeFileAtomic(filename, []byte("edited"), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock() error = %v", err)
+	}
+
+	var second func() error
+	select {
+	case second = <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second lock not acquired after the first was released")
+	}
+	if second == nil {
+		return
+	}
+	defer second()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == nil {
+		t.Error("the replacement file is not locked by the second waiter")
+	}
+}
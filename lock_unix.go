@@ -0,0 +1,41 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory lock on filename, blocking until it is
+// available. The returned function releases the lock. An atomic write
+// replaces the file with a new one while the lock is held, so a lock won on
+// a file that has since been replaced is dropped and taken again on the file
+// now at filename.
+func lockFile(filename string) (func() error, error) {
+	for {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		locked, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		current, err := os.Stat(filename)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if os.SameFile(locked, current) {
+			return f.Close, nil
+		}
+		f.Close()
+	}
+}
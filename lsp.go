@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+)
+
+// lspPosition is a position in a document as defined by the Language Server
+// Protocol: 0-based line and character.
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// lspRange is an LSP range; end is exclusive.
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+// lspTextEdit is an LSP TextEdit.
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+// lspDocument identifies a document by URI, like an LSP
+// OptionalVersionedTextDocumentIdentifier whose version is unknown.
+type lspDocument struct {
+	URI     string `json:"uri"`
+	Version *int   `json:"version"`
+}
+
+// lspDocumentEdit is an LSP TextDocumentEdit: the edits of one file.
+type lspDocumentEdit struct {
+	TextDocument lspDocument   `json:"textDocument"`
+	Edits        []lspTextEdit `json:"edits"`
+}
+
+// newLSPEdit describes result as the edit of filename that an editor would
+// apply to its buffer. Characters count runes, or UTF-16 code units if the
+// format asks for them. A file left unchanged has no edits.
+func newLSPEdit(filename string, result editResult, format positionFormat) lspDocumentEdit {
+	format.zeroBased, format.runes = true, !format.utf16
+	edits := []lspTextEdit{}
+	if !result.unchanged && result.skipped == "" {
+		startLine, startChar := offsetPosition(result.original, result.start, format)
+		endLine, endChar := offsetPosition(result.original, result.end, format)
+		edits = append(edits, lspTextEdit{
+			Range: lspRange{
+				Start: lspPosition{startLine, startChar},
+				End:   lspPosition{endLine, endChar},
+			},
+			NewText: result.replacement,
+		})
+	}
+	return lspDocumentEdit{TextDocument: lspDocument{URI: fileURI(filename)}, Edits: edits}
+}
+
+// fileURI returns the file:// URI of filename.
+func fileURI(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(filename)}
+	return u.String()
+}
+
+func writeLSPEdit(w io.Writer, edit lspDocumentEdit) error {
+	encoder := json.NewEncoder(w)
+	return encoder.Encode(edit)
+}
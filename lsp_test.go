@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewLSPEdit(t *testing.T) {
+	result, err := applyEdit("first\nnaïve 😀 café\nlast\n", "café\nlast", "tea", editOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		format positionFormat
+		want   lspRange
+	}{
+		{"runes", positionFormat{}, lspRange{lspPosition{1, 8}, lspPosition{2, 4}}},
+		{"runes ignore base", positionFormat{zeroBased: false, runes: true}, lspRange{lspPosition{1, 8}, lspPosition{2, 4}}},
+		{"utf16", positionFormat{utf16: true}, lspRange{lspPosition{1, 9}, lspPosition{2, 4}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edit := newLSPEdit("app.py", result, tt.format)
+			if len(edit.Edits) != 1 {
+				t.Fatalf("newLSPEdit() has %d edits, want 1", len(edit.Edits))
+			}
+			if got := edit.Edits[0]; got.Range != tt.want || got.NewText != "tea" {
+				t.Errorf("newLSPEdit() = %+v, want range %+v and new text %q", got, tt.want, "tea")
+			}
+			if !strings.HasPrefix(edit.TextDocument.URI, "file:///") || !strings.HasSuffix(edit.TextDocument.URI, "/app.py") {
+				t.Errorf("newLSPEdit() URI = %q, want an absolute file URI", edit.TextDocument.URI)
+			}
+		})
+	}
+}
+
+func TestNewLSPEditUnchanged(t *testing.T) {
+	result := editResult{original: "a\n", content: "a\n", unchanged: true}
+	var buf strings.Builder
+	if err := writeLSPEdit(&buf, newLSPEdit("a.txt", result, positionFormat{})); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"edits":[]`) {
+		t.Errorf("writeLSPEdit() = %s, want an empty list of edits", buf.String())
+	}
+}
@@ -2,77 +2,1190 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
+// runOptions holds the command-line options that apply to every edit.
+type runOptions struct {
+	parse           parseOptions
+	edit            editOptions
+	dryRun          bool
+	create          bool
+	survey          bool
+	summaryJSON     bool
+	emitPatch       string
+	prompt          *blockPrompt
+	deterministic   bool
+	keepGoing       bool
+	jsonOutput      bool
+	jsonErrors      bool
+	lspEdit         bool
+	chmodWritable   bool
+	lock            bool
+	root            string
+	allowOutside    bool
+	atomic          bool
+	backup          bool
+	backupKeep      int
+	backupSuffix    string
+	contextLines    int
+	showLineNumbers bool
+	wordDiff        bool
+	printMatch      bool
+	verbose         bool
+	reportUnchanged bool
+	force           bool
+	trimReplace     bool
+	unescapeReplace bool
+	convertIndent   bool
+	roundTripCheck  bool
+	formatCmd       string
+	formatRollback  bool
+	timeout         time.Duration
+	matchTimeout    time.Duration
+	requirePresent  string
+	requireAbsent   string
+	lint            bool
+	bestEffort      bool
+	printHash       bool
+	countLines      bool
+	expectSHA256    string
+	expectOutput    string
+	pager           bool
+	expandEnv       bool
+	allowUnsetEnv   bool
+	requireGitClean bool
+	detectEncoding  bool
+	gzip            bool
+	stripOnWrite    bool
+	minSearchLength int
+	position        positionFormat
+}
+
 func main() {
-	var explain bool
+	var explain, server, diffOnly, dumpParse, listEdits, diagnose, appendMode, prependMode bool
+	var explainFormat, diffPath, manifestPath, delimiter, searchFrom, replaceFrom, at string
+	var length, positionBase int
+	maxDiffSize := sizeValue(defaultMaxDiffSize)
+	var columnUnit, lang, filesCmd, editArg, trailingNewline string
+	var ignoreComments, confirmEach bool
+	var stdinTimeout time.Duration
+	var opts runOptions
 	flag.BoolVar(&explain, "explain", false, "Show example usage")
-	flag.Parse()
+	flag.StringVar(&explainFormat, "explain-format", "heredoc", "How --explain passes the diff in its example: heredoc or file")
+	flag.StringVar(&diffPath, "diff", "", "Read the diff from this file instead of stdin")
+	flag.StringVar(&editArg, "edit", "", "Take the whole diff from this argument instead of stdin")
+	flag.DurationVar(&stdinTimeout, "stdin-timeout", 0, "Give up if the diff on stdin hasn't been read completely within this time (e.g. 10s)")
+	flag.StringVar(&filesCmd, "files-from-cmd", "", "Also edit the files listed by this shell command, separated by NULs or newlines")
+	flag.Var(&maxDiffSize, "max-diff-size", "Refuse diffs larger than this, e.g. 512K or 16M (0 for no limit)")
+	flag.StringVar(&searchFrom, "search-from", "", "Use the contents of this file as the search block")
+	flag.StringVar(&replaceFrom, "replace-from", "", "Use the contents of this file as the replace block")
+	flag.StringVar(&manifestPath, "manifest", "", "Apply the edits listed in this JSON manifest of {\"file\", \"diff\"} entries")
+	flag.StringVar(&opts.root, "root", "", "Resolve file names from a manifest, --server request or --delimiter stream relative to this directory")
+	flag.BoolVar(&opts.allowOutside, "allow-outside-root", false, "With --root, allow file names that resolve outside the root directory")
+	flag.StringVar(&delimiter, "delimiter", "", "Split the diff input on lines equal to this text and apply each part as a separate diff")
+	flag.BoolVar(&server, "server", false, "Read newline-delimited JSON edit requests from stdin until it is closed")
+	flag.BoolVar(&diffOnly, "diff-only", false, "Parse the diff from stdin and print it in canonical form without editing any file")
+	flag.BoolVar(&dumpParse, "dump-parse", false, "Print the parsed blocks with visible whitespace without editing any file")
+	flag.BoolVar(&listEdits, "list-edits", false, "List the blocks of the diff and where they match in the given files, without editing them")
+	flag.BoolVar(&diagnose, "diagnose", false, "Explain why the diff doesn't apply to the given files and what would make it apply, without editing them")
+	flag.BoolVar(&opts.parse.noTrim, "no-trim", false, "Parse the diff exactly as given instead of trimming surrounding whitespace")
+	flag.StringVar(&opts.parse.markerEscape, "marker-escape", "", "Prefix that makes a marker line part of a block, e.g. \\; it is stripped once from such lines")
+	flag.BoolVar(&opts.parse.reverse, "reverse", false, "Swap the search and replace blocks to undo a previously applied diff")
+	flag.BoolVar(&opts.edit.ignoreEOLWhitespace, "ignore-eol-whitespace", false, "Ignore trailing whitespace on each line when matching")
+	flag.BoolVar(&opts.edit.equivalentIndent, "equivalent-indent", false, "Treat tabs and spaces in indentation as equal when they reach the same column")
+	flag.IntVar(&opts.edit.tabWidth, "tab-width", defaultTabWidth, "Columns per tab stop for --equivalent-indent and --convert-indent")
+	flag.BoolVar(&opts.unescapeReplace, "unescape-replace", false, "Interpret \\n, \\t and \\\\ in the replace block as newline, tab and backslash")
+	flag.BoolVar(&opts.convertIndent, "convert-indent", false, "Convert the indentation of the replacement to the file's tabs or spaces")
+	flag.BoolVar(&ignoreComments, "ignore-comments", false, "Ignore comments when matching, using the comment syntax of --lang")
+	flag.StringVar(&lang, "lang", "", "Language of the files for --ignore-comments")
+	flag.IntVar(&opts.edit.fuzz, "fuzz", 0, "Allow up to N lines of the search block to differ when there is no exact match (risky)")
+	flag.BoolVar(&opts.edit.noNormalize, "no-normalize", false, "Match the raw bytes of the file, so that CRLF is only matched by CRLF in the search block")
+	flag.BoolVar(&opts.edit.tolerateBlankLines, "tolerate-blank-lines", false, "Match even if blank lines were added or removed inside the search block")
+	flag.BoolVar(&opts.edit.anchorFirstLine, "anchor-first-line", false, "Match the first line of the search block at any indentation if the rest matches exactly")
+	flag.BoolVar(&opts.edit.uniqueAnchor, "prefer-longest-unique-anchor", false, "Resolve an ambiguous match by the lines around each occurrence when that singles one out")
+	flag.StringVar(&opts.edit.occurrenceHash, "occurrence-hash", "", "Edit the occurrence whose surrounding lines have this SHA-256 (or a prefix of it), as shown by --match-report")
+	flag.BoolVar(&opts.edit.matchReport, "match-report", false, "List every candidate region with its similarity when the match is ambiguous")
+	flag.BoolVar(&opts.edit.lineAnchored, "line-anchored", false, "Only match the search block where it spans whole lines, ignoring matches inside lines")
+	flag.BoolVar(&opts.edit.wholeWord, "whole-word", false, "Only match the search text where it is not part of a longer word, for identifier renames")
+	flag.StringVar(&trailingNewline, "search-trailing-newline", "strip", "Whether the search block must be followed by a line break: keep, strip or auto (whichever matches uniquely)")
+	flag.BoolVar(&opts.edit.preserveCase, "replace-preserving-case", false, "Match regardless of case and give the replacement the ALL CAPS or Title Case of the matched text; needs --whole-word")
+	flag.StringVar(&opts.edit.wildcardLine, "wildcard-line", "", "Let a search block line consisting of this text, e.g. ..., match any number of lines")
+	flag.BoolVar(&opts.edit.wholeLines, "whole-lines", false, "Require the match to start and end at line boundaries")
+	flag.StringVar(&opts.edit.contextBefore, "context-before", "", "Only match occurrences immediately preceded by these lines")
+	flag.StringVar(&opts.edit.contextAfter, "context-after", "", "Only match occurrences immediately followed by these lines")
+	flag.IntVar(&opts.edit.trailingContextCount, "trailing-context-count", 0, "Fail unless the match is followed by the N lines of --context-after, instead of using them to pick a match")
+	flag.StringVar(&at, "at", "", "Replace text at LINE:COL instead of searching; the replacement is read from stdin")
+	flag.IntVar(&length, "length", 0, "Number of bytes to replace with --at")
+	flag.BoolVar(&opts.edit.idempotent, "idempotent", false, "Succeed without changes if the search block is missing but the replace block is already present")
+	flag.BoolVar(&appendMode, "append", false, "Append the replace block to the end of the file instead of searching")
+	flag.BoolVar(&prependMode, "prepend", false, "Insert the replace block at the start of the file instead of searching")
+	flag.BoolVar(&opts.trimReplace, "trim-replace", false, "Strip trailing whitespace from each line of the replace block")
+	flag.StringVar(&opts.requirePresent, "require-present", "", "Skip files that don't contain this text")
+	flag.StringVar(&opts.requireAbsent, "require-absent", "", "Skip files that already contain this text")
+	flag.IntVar(&opts.minSearchLength, "min-search-length", 0, "Reject search blocks shorter than N characters (only warn with --lint)")
+	flag.BoolVar(&opts.roundTripCheck, "round-trip-check", false, "Warn if applying the edit in reverse would not restore the original content")
+	flag.BoolVar(&opts.lint, "lint", false, "Warn on stderr about search and replace blocks that look wrong")
+	flag.BoolVar(&opts.bestEffort, "best-effort", false, "With several blocks in the diff, apply those that match and skip the rest (exit code 2)")
+	flag.BoolVar(&opts.countLines, "count-lines-changed", false, "Report how many lines each edit removed and added")
+	flag.BoolVar(&opts.printHash, "print-hash", false, "Print the SHA-256 of the resulting file content")
+	flag.StringVar(&opts.expectSHA256, "expect-sha256", "", "Refuse to edit a file unless its current content has this SHA-256")
+	flag.StringVar(&opts.expectOutput, "expect-output", "", "Compare the edited content against this file instead of writing it; implies --dry-run")
+	flag.BoolVar(&opts.pager, "pager", false, "Show dry-run previews through $PAGER when stdout is a terminal")
+	flag.BoolVar(&opts.expandEnv, "expand-env", false, "Expand ${VAR} in the replace block from the environment ($$ is a literal $)")
+	flag.BoolVar(&opts.allowUnsetEnv, "allow-unset-env", false, "With --expand-env, expand unset variables to nothing instead of failing")
+	flag.BoolVar(&opts.stripOnWrite, "strip-trailing-whitespace", false, "Strip trailing whitespace from every line of the file when writing it")
+	flag.IntVar(&positionBase, "position-base", 1, "Number reported match lines and columns from 0 or 1")
+	flag.StringVar(&columnUnit, "column-unit", "byte", "Count reported match columns in bytes, runes or UTF-16 code units: byte, rune or utf16")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "Preview the edit without writing the file")
+	flag.StringVar(&opts.formatCmd, "format-cmd", "", "Run this command on each edited file after writing it, with {} replaced by the file name")
+	flag.BoolVar(&opts.formatRollback, "format-rollback", false, "Restore the original content if --format-cmd fails")
+	flag.BoolVar(&opts.create, "create", false, "Create missing files with --append, --prepend or --at instead of failing")
+	flag.BoolVar(&opts.survey, "dry-run-all", false, "Report for every file whether the edit would apply, without writing anything")
+	flag.BoolVar(&opts.jsonOutput, "json", false, "Print the result as JSON")
+	flag.BoolVar(&opts.lspEdit, "lsp-edit", false, "Print the edit of each file as an LSP TextDocumentEdit instead of writing it; implies --dry-run")
+	flag.BoolVar(&opts.jsonErrors, "json-errors", false, "Print errors to stderr as JSON with a category, leaving other output as it is")
+	flag.BoolVar(&opts.summaryJSON, "summary-json", false, "Print a single JSON summary of all files instead of per-file results")
+	flag.StringVar(&opts.emitPatch, "emit-patch", "", "Write the changes made to every file as a unified diff to this file")
+	flag.BoolVar(&confirmEach, "confirm-each", false, "Show each block that matches and ask on the terminal whether to apply it")
+	flag.BoolVar(&opts.keepGoing, "keep-going", false, "Skip failing blocks like --best-effort and list every failure at the end")
+	flag.BoolVar(&opts.deterministic, "deterministic", false, "Process files in sorted order so that output is reproducible")
+	flag.IntVar(&opts.contextLines, "context-lines", defaultContextLines, "Number of unchanged lines to show around the change in previews")
+	flag.BoolVar(&opts.showLineNumbers, "show-line-numbers", false, "Prefix preview lines with their line numbers")
+	flag.BoolVar(&opts.wordDiff, "word-diff", false, "Highlight the words that changed in the preview instead of showing whole lines")
+	flag.BoolVar(&opts.printMatch, "print-match", false, "Print the matched region with line numbers to stderr")
+	flag.BoolVar(&opts.chmodWritable, "chmod-writable", false, "Temporarily make read-only files writable to apply the edit")
+	flag.BoolVar(&opts.atomic, "atomic", false, "Write through a temporary file that is renamed into place")
+	flag.BoolVar(&opts.backup, "backup", false, "Save the original file as <filename>.bak before writing")
+	flag.Var(inPlaceValue{&opts.backupSuffix}, "i", "Edit in place like sed -i; -iSUFFIX (e.g. -i.orig) also keeps a backup named <filename>SUFFIX")
+	flag.IntVar(&opts.backupKeep, "backup-keep", 0, "Keep up to N rotated backups as <filename>.bak.1 (newest) to <filename>.bak.N")
+	flag.BoolVar(&opts.lock, "lock", false, "Hold an advisory lock on the file while editing it")
+	flag.BoolVar(&opts.requireGitClean, "require-git-clean", false, "Refuse to edit files with uncommitted git changes (only warn with --force)")
+	flag.BoolVar(&opts.gzip, "gzip", false, "Edit files as gzip-compressed even if their name doesn't end in .gz")
+	flag.BoolVar(&opts.detectEncoding, "detect-encoding", false, "Detect UTF-16 files by their byte order mark or content and edit them in their encoding")
+	flag.BoolVar(&opts.force, "force", false, "Bypass safety checks such as binary file detection")
+	flag.BoolVar(&opts.verbose, "verbose", false, "Print per-file progress to stderr")
+	flag.DurationVar(&opts.timeout, "timeout", 0, "Abort the edit of a file if it takes longer than this (e.g. 30s); implies --atomic")
+	flag.DurationVar(&opts.matchTimeout, "match-timeout", 0, "Abort the edit of a file if finding the search text takes longer than this (e.g. 5s)")
+	flag.BoolVar(&opts.reportUnchanged, "report-unchanged", false, "Treat files without a match as unchanged and summarize them at the end")
+	flag.String("config", "", "Read default option values from this JSON file instead of "+defaultConfigFile)
+
+	args := expandInPlaceArgs(flag.CommandLine, os.Args[1:])
+	if path, explicit := configPath(flag.CommandLine, args); path != "" {
+		if err := loadConfig(flag.CommandLine, path, explicit); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	flag.CommandLine.Parse(args)
+
+	if positionBase != 0 && positionBase != 1 {
+		fmt.Fprintf(os.Stderr, "Error: --position-base must be 0 or 1\n")
+		os.Exit(1)
+	}
+	opts.position.zeroBased = positionBase == 0
+	if opts.edit.fuzz < 0 || opts.edit.fuzz > maxFuzz {
+		fmt.Fprintf(os.Stderr, "Error: --fuzz must be between 0 and %d\n", maxFuzz)
+		os.Exit(1)
+	}
+	if opts.expectOutput != "" || opts.lspEdit {
+		opts.dryRun = true
+	}
+	if opts.keepGoing {
+		opts.bestEffort = true
+	}
+	if ignoreComments {
+		if lang == "" {
+			fmt.Fprintf(os.Stderr, "Error: --ignore-comments needs --lang\n")
+			os.Exit(1)
+		}
+		syntax, err := lookupLanguage(lang)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.edit.comments = syntax
+	}
+	if opts.survey && (opts.jsonOutput || opts.summaryJSON) {
+		fmt.Fprintf(os.Stderr, "Error: --dry-run-all cannot be combined with --json or --summary-json\n")
+		os.Exit(1)
+	}
+	if opts.lspEdit && (opts.survey || opts.jsonOutput || opts.summaryJSON) {
+		fmt.Fprintf(os.Stderr, "Error: --lsp-edit cannot be combined with --dry-run-all, --json or --summary-json\n")
+		os.Exit(1)
+	}
+	if opts.summaryJSON && opts.jsonOutput {
+		fmt.Fprintf(os.Stderr, "Error: --summary-json cannot be combined with --json\n")
+		os.Exit(1)
+	}
+	if opts.edit.occurrenceHash != "" {
+		if err := checkHashPrefix(opts.edit.occurrenceHash); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if opts.edit.preserveCase && !opts.edit.wholeWord {
+		fmt.Fprintf(os.Stderr, "Error: --replace-preserving-case needs --whole-word\n")
+		os.Exit(1)
+	}
+	if editArg != "" {
+		if diffPath != "" {
+			fmt.Fprintf(os.Stderr, "Error: --edit cannot be combined with --diff\n")
+			os.Exit(1)
+		}
+		if stdinHasInput() {
+			fmt.Fprintf(os.Stderr, "Error: --edit cannot be combined with a diff on stdin\n")
+			os.Exit(1)
+		}
+	}
+	if n := opts.edit.trailingContextCount; n != 0 {
+		if _, ok := trailingContextLines(opts.edit.contextAfter, n); n < 0 || !ok {
+			fmt.Fprintf(os.Stderr, "Error: --trailing-context-count %d needs --context-after with exactly that many lines\n", n)
+			os.Exit(1)
+		}
+	}
+	if opts.allowOutside && opts.root == "" {
+		fmt.Fprintf(os.Stderr, "Error: --allow-outside-root needs --root\n")
+		os.Exit(1)
+	}
+	if opts.root != "" {
+		if info, err := os.Stat(opts.root); err != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: --root %s is not a directory\n", opts.root)
+			os.Exit(1)
+		}
+	}
+	if confirmEach {
+		if opts.timeout > 0 || opts.matchTimeout > 0 || opts.survey {
+			fmt.Fprintf(os.Stderr, "Error: --confirm-each cannot be combined with --timeout, --match-timeout or --dry-run-all\n")
+			os.Exit(1)
+		}
+		prompt, err := newBlockPrompt(opts.contextLines)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --confirm-each needs a terminal: %v\n", err)
+			os.Exit(1)
+		}
+		opts.prompt = prompt
+	}
+	mode, err := parseTrailingNewline(trailingNewline)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts.edit.trailingNewline = mode
+	switch columnUnit {
+	case "byte":
+	case "rune":
+		opts.position.runes = true
+	case "utf16":
+		opts.position.utf16 = true
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown --column-unit %q (want byte, rune or utf16)\n", columnUnit)
+		os.Exit(1)
+	}
 
 	if explain {
-		showExample()
+		if explainFormat != "heredoc" && explainFormat != "file" {
+			fmt.Fprintf(os.Stderr, "Error: unknown --explain-format %q (want heredoc or file)\n", explainFormat)
+			os.Exit(1)
+		}
+		showExample(explainFormat)
+		return
+	}
+
+	if server {
+		if err := runServer(os.Stdin, os.Stdout, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in server mode: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if diffOnly {
+		diff, err := loadDiff(editArg, diffPath, int64(maxDiffSize), stdinTimeout)
+		if err != nil {
+			reportError(os.Stderr, opts, "reading diff", err)
+			os.Exit(readDiffExitCode(err))
+		}
+		searchBlock, replaceBlock, err := parseDiffWith(diff, opts.parse)
+		if err != nil {
+			reportError(os.Stderr, opts, "parsing diff", err)
+			os.Exit(1)
+		}
+		fmt.Print(formatDiff(searchBlock, replaceBlock))
 		return
 	}
 
-	if flag.NArg() != 1 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [--explain] <filename>\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Use --explain to see example usage\n")
-		os.Exit(1)
+	if dumpParse {
+		diff, err := loadDiff(editArg, diffPath, int64(maxDiffSize), stdinTimeout)
+		if err != nil {
+			reportError(os.Stderr, opts, "reading diff", err)
+			os.Exit(readDiffExitCode(err))
+		}
+		blocks, err := parseBlocks(diff, opts.parse)
+		if err != nil {
+			reportError(os.Stderr, opts, "parsing diff", err)
+			os.Exit(1)
+		}
+		writeParseDump(os.Stdout, blocks)
+		return
+	}
+
+	if listEdits || diagnose {
+		diff, err := loadDiff(editArg, diffPath, int64(maxDiffSize), stdinTimeout)
+		if err != nil {
+			reportError(os.Stderr, opts, "reading diff", err)
+			os.Exit(readDiffExitCode(err))
+		}
+		blocks, err := parseBlocks(diff, opts.parse)
+		if err != nil {
+			reportError(os.Stderr, opts, "parsing diff", err)
+			os.Exit(1)
+		}
+		report := writeDiagnosis
+		if listEdits {
+			writeEditList(os.Stdout, blocks)
+			report = writeEditMatches
+		}
+		code := 0
+		for _, filename := range flag.Args() {
+			ok, err := report(os.Stdout, filename, blocks, opts.edit)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			}
+			if !ok {
+				code = 1
+			}
+		}
+		os.Exit(code)
+	}
+
+	if manifestPath != "" {
+		jobs, err := loadManifest(manifestPath, opts)
+		if err != nil {
+			reportError(os.Stderr, opts, "reading manifest", err)
+			os.Exit(1)
+		}
+		os.Exit(runBatch(jobs, opts))
+	}
+
+	filenames := flag.Args()
+	if filesCmd != "" {
+		// Run it before anything is edited, so that a failing command
+		// leaves every file alone
+		listed, err := filesFromCommand(filesCmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing files: %v\n", err)
+			os.Exit(1)
+		}
+		if len(listed) == 0 {
+			fmt.Fprintf(os.Stderr, "Error listing files: %q listed no files\n", filesCmd)
+			os.Exit(1)
+		}
+		filenames = append(filenames, listed...)
+	}
+
+	if delimiter != "" {
+		if countTrue(at != "", appendMode, prependMode) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: --delimiter cannot be combined with --at, --append or --prepend\n")
+			os.Exit(1)
+		}
+		diff, err := loadDiff(editArg, diffPath, int64(maxDiffSize), stdinTimeout)
+		if err != nil {
+			reportError(os.Stderr, opts, "reading diff", err)
+			os.Exit(readDiffExitCode(err))
+		}
+		jobs, err := delimitedJobs(diff, delimiter, filenames, opts)
+		if err != nil {
+			reportError(os.Stderr, opts, "splitting diff", err)
+			os.Exit(1)
+		}
+		os.Exit(runBatch(jobs, opts))
+	}
+
+	if len(filenames) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <filename>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Use --explain to see example usage\n")
+		os.Exit(1)
+	}
+
+	if countTrue(at != "", appendMode, prependMode) > 1 {
+		fmt.Fprintf(os.Stderr, "Error: only one of --at, --append and --prepend can be used\n")
+		os.Exit(1)
+	}
+	searching := countTrue(at != "", appendMode, prependMode) == 0
+	if !searching && searchFrom != "" {
+		fmt.Fprintf(os.Stderr, "Error: --search-from cannot be combined with --at, --append or --prepend\n")
+		os.Exit(1)
+	}
+	if searching && opts.create {
+		fmt.Fprintf(os.Stderr, "Error: --create needs --append, --prepend or --at\n")
+		os.Exit(1)
+	}
+	if !searching && opts.edit.noNormalize {
+		fmt.Fprintf(os.Stderr, "Error: --no-normalize cannot be combined with --at, --append or --prepend\n")
+		os.Exit(1)
+	}
+	if !searching && opts.parse.reverse {
+		fmt.Fprintf(os.Stderr, "Error: --reverse cannot be combined with --at, --append or --prepend\n")
+		os.Exit(1)
+	}
+
+	// Read diff from stdin, unless every block comes from elsewhere
+	var diff string
+	if replaceFrom == "" || searching && searchFrom == "" {
+		var err error
+		diff, err = loadDiff(editArg, diffPath, int64(maxDiffSize), stdinTimeout)
+		if err != nil {
+			reportError(os.Stderr, opts, "reading diff", err)
+			os.Exit(readDiffExitCode(err))
+		}
+	}
+
+	parseStart := time.Now()
+	var edit editFunc
+	if !searching {
+		var replaceBlock string
+		var err error
+		if replaceFrom != "" {
+			replaceBlock, err = readBlockFile(replaceFrom)
+		} else {
+			replaceBlock, err = parseReplaceBlock(diff, opts.parse)
+		}
+		if err != nil {
+			reportError(os.Stderr, opts, "parsing diff", err)
+			os.Exit(1)
+		}
+		replaceBlock, err = transformReplace(replaceBlock, opts)
+		if err != nil {
+			reportError(os.Stderr, opts, "in replace block", err)
+			os.Exit(1)
+		}
+
+		switch {
+		case appendMode:
+			edit = appendBlock(replaceBlock)
+		case prependMode:
+			edit = prependBlock(replaceBlock)
+		default:
+			line, col, err := parsePosition(at)
+			if err != nil {
+				reportError(os.Stderr, opts, "parsing --at", err)
+				os.Exit(1)
+			}
+			edit = replaceAt(line, col, length, replaceBlock)
+		}
+	} else {
+		// Parse the diff
+		blocks, err := loadBlocks(diff, searchFrom, replaceFrom, opts.parse)
+		if err != nil {
+			reportError(os.Stderr, opts, "parsing diff", err)
+			os.Exit(1)
+		}
+		if opts.lint {
+			writeLintWarnings(os.Stderr, "", blocks, opts.minSearchLength)
+		}
+		edit, err = blocksEdit(blocks, opts)
+		if err != nil {
+			reportError(os.Stderr, opts, "in diff", err)
+			os.Exit(1)
+		}
+	}
+	if opts.verbose {
+		writePhaseTime(os.Stderr, "diff", "parse", time.Since(parseStart))
+	}
+
+	jobs := make([]editJob, len(filenames))
+	for i, filename := range filenames {
+		jobs[i] = editJob{filename: filename, edit: edit}
+	}
+	os.Exit(runBatch(jobs, opts))
+}
+
+// defaultMaxDiffSize is the largest diff read by default. Nothing near it is
+// a reasonable diff, so it only trips on input piped in by mistake.
+const defaultMaxDiffSize = 64 << 20
+
+// sizeValue is a flag holding a number of bytes, written with an optional
+// K, M or G suffix for powers of 1024.
+type sizeValue int64
+
+var sizeUnits = []struct {
+	suffix string
+	shift  uint
+}{{"G", 30}, {"M", 20}, {"K", 10}}
+
+func (v sizeValue) String() string {
+	for _, unit := range sizeUnits {
+		if v != 0 && v%(1<<unit.shift) == 0 {
+			return fmt.Sprintf("%d%s", v>>unit.shift, unit.suffix)
+		}
+	}
+	return strconv.FormatInt(int64(v), 10)
+}
+
+func (v *sizeValue) Set(s string) error {
+	number := strings.ToUpper(s)
+	var shift uint
+	for _, unit := range sizeUnits {
+		if rest, ok := strings.CutSuffix(number, unit.suffix); ok {
+			number, shift = rest, unit.shift
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64>>shift {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*v = sizeValue(n << shift)
+	return nil
+}
+
+// inPlaceValue is the sed-style -i[SUFFIX] flag. Files are always edited in
+// place, so a bare -i changes nothing; a suffix makes a backup with that
+// suffix before writing, taking the place of the .bak of --backup.
+type inPlaceValue struct {
+	suffix *string
+}
+
+func (v inPlaceValue) String() string {
+	if v.suffix == nil {
+		return ""
+	}
+	return *v.suffix
+}
+
+func (v inPlaceValue) Set(s string) error {
+	if s == "true" {
+		// A bare -i
+		*v.suffix = ""
+		return nil
+	}
+	if strings.ContainsRune(s, os.PathSeparator) || strings.ContainsRune(s, '/') {
+		return fmt.Errorf("backup suffix %q must not contain a path separator", s)
+	}
+	*v.suffix = s
+	return nil
+}
+
+func (v inPlaceValue) IsBoolFlag() bool { return true }
+
+// expandInPlaceArgs rewrites sed-style -iSUFFIX arguments as -i=SUFFIX, which
+// the flag package understands. Values of other flags and arguments after the
+// flags are left alone.
+func expandInPlaceArgs(flags *flag.FlagSet, args []string) []string {
+	expanded := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "-" || !strings.HasPrefix(arg, "-") {
+			return append(expanded, args[i:]...)
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		if strings.Contains(name, "=") {
+			expanded = append(expanded, arg)
+			continue
+		}
+		if f := flags.Lookup(name); f != nil {
+			expanded = append(expanded, arg)
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); (!ok || !b.IsBoolFlag()) && i+1 < len(args) {
+				// The next argument is this flag's value
+				i++
+				expanded = append(expanded, args[i])
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "-i") && !strings.HasPrefix(arg, "--") {
+			arg = "-i=" + arg[2:]
+		}
+		expanded = append(expanded, arg)
+	}
+	return expanded
+}
+
+// reportResult prints the outcome of a successful edit in the requested
+// output mode.
+func reportResult(w io.Writer, filename string, result editResult, opts runOptions) error {
+	if !opts.jsonOutput && !opts.lspEdit && result.sha256 != "" {
+		defer fmt.Fprintf(w, "%s  %s\n", result.sha256, filename)
+	}
+	if !opts.jsonOutput && !opts.lspEdit && opts.countLines && result.skipped == "" {
+		defer writeLineChanges(w, filename, result)
+	}
+
+	switch {
+	case opts.jsonOutput:
+		return writeJSON(w, newJSONResult(filename, result, opts))
+	case opts.lspEdit:
+		return writeLSPEdit(w, newLSPEdit(filename, result, opts.position))
+	case result.skipped != "":
+		fmt.Fprintf(w, "Skipped %s: %s\n", filename, result.skipped)
+	case result.unchanged:
+		fmt.Fprintf(w, "No changes written to %s\n", filename)
+	case opts.dryRun:
+		if opts.wordDiff {
+			writeWordDiff(w, filename, newPreview(result, opts.contextLines))
+		} else {
+			writePreview(w, filename, newPreview(result, opts.contextLines), opts.showLineNumbers)
+		}
+	case len(result.skippedBlocks()) > 0:
+		fmt.Fprintf(w, "Applied %d of %d blocks to %s\n", len(result.blocks)-len(result.skippedBlocks()), len(result.blocks), filename)
+	default:
+		fmt.Fprintf(w, "Successfully applied edit to %s\n", filename)
+	}
+	return nil
+}
+
+// writeLineChanges prints how many lines an edit removed and added.
+func writeLineChanges(w io.Writer, filename string, result editResult) {
+	fmt.Fprintf(w, "%s: %d lines removed, %d added (net %+d)\n", filename, result.linesRemoved, result.linesAdded, result.linesAdded-result.linesRemoved)
+}
+
+// sha256Hex returns the hex-encoded SHA-256 of data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isBinary reports whether data looks like a binary file, using the same
+// heuristic as git: a NUL byte near the start.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) != -1
+}
+
+// editFunc computes an edit of some file content. Searching stops early once
+// ctx is done.
+type editFunc func(ctx context.Context, content string) (editResult, error)
+
+// transformReplace applies the requested expansions and clean-ups to a
+// replace block before it is spliced into a file.
+func transformReplace(replaceBlock string, opts runOptions) (string, error) {
+	if opts.unescapeReplace {
+		replaceBlock = unescapeReplace(replaceBlock)
+	}
+	if opts.expandEnv {
+		var err error
+		replaceBlock, err = expandEnv(replaceBlock, os.LookupEnv, opts.allowUnsetEnv)
+		if err != nil {
+			return "", err
+		}
+	}
+	if opts.trimReplace {
+		replaceBlock = trimTrailingWhitespace(replaceBlock)
+	}
+	return replaceBlock, nil
+}
+
+// unescapeReplace turns the escape sequences \n, \t and \\ into the
+// characters they stand for. A backslash before anything else is kept as is.
+func unescapeReplace(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+	}
+	return b.String()
+}
+
+// trimTrailingWhitespace strips spaces and tabs from the end of every line,
+// keeping the line endings themselves (including a CR before the LF).
+func trimTrailingWhitespace(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		cr := strings.HasSuffix(line, "\r")
+		line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " \t")
+		if cr {
+			line += "\r"
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// searchReplace is the default edit: replace the search block with the
+// replace block.
+func searchReplace(searchBlock, replaceBlock string, opts editOptions) editFunc {
+	return func(ctx context.Context, content string) (editResult, error) {
+		opts.ctx = ctx
+		return applyEdit(content, searchBlock, replaceBlock, opts)
+	}
+}
+
+// blocksEdit returns the edit for the blocks of a parsed diff.
+func blocksEdit(blocks []diffBlock, opts runOptions) (editFunc, error) {
+	for i := range blocks {
+		err := checkSearchLength(blocks[i].search, opts.minSearchLength)
+		if opts.lint {
+			// Reported as a lint warning instead
+			err = nil
+		}
+		if err == nil && opts.edit.wildcardLine != "" {
+			err = checkWildcard(blocks[i].search, opts.edit.wildcardLine)
+		}
+		var replaceBlock string
+		if err == nil {
+			replaceBlock, err = transformReplace(blocks[i].replace, opts)
+		}
+		if err != nil {
+			if len(blocks) > 1 {
+				err = fmt.Errorf("block %d: %w", i+1, err)
+			}
+			return nil, err
+		}
+		blocks[i].replace = replaceBlock
+	}
+	if opts.prompt != nil {
+		return searchReplaceBlocksWith(blocks, opts.edit, opts.bestEffort, opts.prompt.confirm), nil
+	}
+	if len(blocks) == 1 {
+		return searchReplace(blocks[0].search, blocks[0].replace, opts.edit), nil
+	}
+	return searchReplaceBlocks(blocks, opts.edit, opts.bestEffort), nil
+}
+
+// searchReplaceBlocks applies the blocks of a multi-block diff one after the
+// other, each to the result of the previous ones, so the offsets of later
+// blocks are never affected by earlier ones. A block that fails fails the
+// whole edit unless bestEffort is set, in which case it is skipped and
+// recorded in the result. At least one block must apply.
+func searchReplaceBlocks(blocks []diffBlock, opts editOptions, bestEffort bool) editFunc {
+	return searchReplaceBlocksWith(blocks, opts, bestEffort, nil)
+}
+
+// confirmFunc decides whether to apply block (0-based) of total, given the
+// result of applying it.
+type confirmFunc func(block, total int, result editResult) (bool, error)
+
+// searchReplaceBlocksWith is searchReplaceBlocks asking confirm, if not nil,
+// before applying each block that matches. A declined block is skipped like
+// a failing one with bestEffort, except that declining every block leaves
+// the content unchanged rather than failing.
+func searchReplaceBlocksWith(blocks []diffBlock, opts editOptions, bestEffort bool, confirm confirmFunc) editFunc {
+	return func(ctx context.Context, content string) (editResult, error) {
+		opts.ctx = ctx
+		original := normalizeWith(content, opts)
+		current := original
+		outcomes := make([]blockOutcome, len(blocks))
+		var notes []string
+		applied, failed := 0, -1
+		for i, block := range blocks {
+			result, err := applyEdit(current, block.search, block.replace, opts)
+			if err == nil && confirm != nil {
+				ok, err := confirm(i, len(blocks), result)
+				if err != nil {
+					return editResult{}, fmt.Errorf("block %d: %w", i+1, err)
+				}
+				if !ok {
+					outcomes[i].err = errDeclined
+					continue
+				}
+			}
+			if err != nil {
+				if !bestEffort {
+					return editResult{}, fmt.Errorf("block %d: %w", i+1, err)
+				}
+				outcomes[i].err = err
+				if failed == -1 {
+					failed = i
+				}
+				continue
+			}
+			current = result.content
+			applied++
+			for _, note := range result.notes {
+				notes = append(notes, fmt.Sprintf("block %d: %s", i+1, note))
+			}
+		}
+		if applied == 0 && failed != -1 {
+			return editResult{}, fmt.Errorf("none of the %d blocks could be applied, block %d: %w", len(blocks), failed+1, outcomes[failed].err)
+		}
+
+		start, end, replacement := changedRegion(original, current)
+		return editResult{
+			original:    original,
+			content:     current,
+			start:       start,
+			end:         end,
+			replacement: replacement,
+			blocks:      outcomes,
+			notes:       notes,
+		}, nil
+	}
+}
+
+// checkRoundTrip reports why swapping the search and replace text of result
+// and applying that to the edited content would not give back the original,
+// for example because the replacement also occurs elsewhere.
+func checkRoundTrip(result editResult, opts editOptions) error {
+	if result.replacement == "" {
+		return errors.New("the replacement is empty, so there is nothing to search for")
+	}
+	opts.fuzz = 0
+	reversed, err := applyEdit(result.content, result.replacement, result.original[result.start:result.end], opts)
+	switch {
+	case errors.Is(err, errAmbiguous):
+		return errors.New("the replacement occurs more than once in the edited content")
+	case errors.Is(err, errSearchNotFound):
+		return errors.New("the replacement is not found in the edited content")
+	case err != nil:
+		return errors.New(strings.TrimSuffix(firstLine(err.Error()), ":"))
+	}
+	if reversed.content != result.original {
+		line := strings.Count(result.content[:reversed.start], "\n") + 1
+		return fmt.Errorf("the replacement is found again at line %d, away from where it was inserted", line)
+	}
+	return nil
+}
+
+// changedRegion returns the range [start, end) of before that differs from
+// after, along with the text that replaces it in after.
+func changedRegion(before, after string) (start, end int, replacement string) {
+	n := min(len(before), len(after))
+	for start < n && before[start] == after[start] {
+		start++
+	}
+	suffix := 0
+	for suffix < n-start && before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+	return start, len(before) - suffix, after[start : len(after)-suffix]
+}
+
+// editFile applies the edit to filename, writing the result back unless this
+// is a dry run.
+func editFile(filename string, edit editFunc, opts runOptions) (editResult, error) {
+	ctx := context.Background()
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	// With --create a missing file is edited as if it were empty and written
+	// from scratch. A named pipe is read to the end and the result written
+	// back into it, for other processes to stream content through.
+	missing, pipe := false, false
+	info, statErr := os.Stat(filename)
+	switch {
+	case errors.Is(statErr, fs.ErrNotExist):
+		missing = opts.create
+	case statErr == nil && info.Mode()&fs.ModeNamedPipe != 0:
+		pipe = true
+	case statErr == nil && !info.Mode().IsRegular():
+		return editResult{}, fmt.Errorf("file %s is %s, not a regular file", filename, fileKind(info.Mode()))
+	}
+
+	if opts.lock && !missing && !pipe {
+		unlock, err := lockFile(filename)
+		if err != nil {
+			return editResult{}, fmt.Errorf("locking file %s: %w", filename, err)
+		}
+		defer unlock()
+	}
+
+	// Read the file
+	readStart := time.Now()
+	var content []byte
+	if !missing {
+		var err error
+		content, err = os.ReadFile(filename)
+		if err != nil {
+			return editResult{}, fmt.Errorf("reading file %s: %w", filename, err)
+		}
+	}
+
+	// A compressed file is edited decompressed; content stays the bytes
+	// on disk, for backups and hashes
+	plain := content
+	var gz *gzipFile
+	if opts.gzip || isGzipName(filename) {
+		gz = &gzipFile{level: gzip.DefaultCompression}
+		if !missing {
+			var err error
+			plain, *gz, err = gunzip(content)
+			if err != nil {
+				return editResult{}, fmt.Errorf("decompressing file %s: %w", filename, err)
+			}
+		}
+	}
+
+	enc := encodingUTF8
+	if opts.detectEncoding {
+		enc = detectEncoding(plain)
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "Detected %s encoding for %s\n", enc, filename)
+		}
+	}
+	text, err := enc.decode(plain)
+	if err != nil {
+		return editResult{}, fmt.Errorf("decoding file %s: %w", filename, err)
+	}
+	if opts.verbose {
+		writePhaseTime(os.Stderr, filename, "read", time.Since(readStart))
+	}
+
+	if !opts.force && isBinary([]byte(text)) {
+		return editResult{}, fmt.Errorf("file %s looks binary; use --force to edit it anyway", filename)
+	}
+
+	if opts.requireGitClean && !opts.dryRun && !missing {
+		if modified, ok := gitModified(filename); ok && modified {
+			if !opts.force {
+				return editResult{}, fmt.Errorf("file %s has uncommitted changes; commit them or use --force", filename)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %s has uncommitted changes\n", filename)
+		}
+	}
+
+	if opts.expectSHA256 != "" {
+		if sum := sha256Hex(content); !strings.EqualFold(sum, opts.expectSHA256) {
+			return editResult{}, fmt.Errorf("file %s has SHA-256 %s, expected %s", filename, sum, opts.expectSHA256)
+		}
+	}
+
+	if reason := checkGuards(text, opts); reason != "" {
+		result := editResult{original: text, content: text, unchanged: true, skipped: reason}
+		if opts.printHash {
+			result.sha256 = sha256Hex(content)
+		}
+		return result, nil
+	}
+
+	// Perform the edit
+	matchStart := time.Now()
+	result, err := runMatch(ctx, edit, text, opts.matchTimeout)
+	if err != nil {
+		return editResult{}, fmt.Errorf("performing edit: %w", err)
+	}
+	if opts.verbose {
+		writePhaseTime(os.Stderr, filename, "match", time.Since(matchStart))
+	}
+	for _, note := range result.notes {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", filename, note)
+	}
+	if opts.convertIndent {
+		result = convertIndent(result, opts.edit.tabStop())
+	}
+	if opts.roundTripCheck {
+		if err := checkRoundTrip(result, opts.edit); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: the edit of %s is not cleanly reversible: %v\n", filename, err)
+		}
+	}
+	// The edit works on normalized text (unless --no-normalize); write it
+	// back with the line endings and encoding the file used
+	newText := result.content
+	if opts.stripOnWrite {
+		newText = trimTrailingWhitespace(newText)
+	}
+	if !opts.edit.noNormalize {
+		newText = denormalize(newText, lineEnding(text))
+	}
+	output := enc.encode(newText)
+	result.unchanged = !missing && bytes.Equal(output, plain)
+	if opts.expectOutput != "" {
+		if err := checkExpectedOutput(opts.expectOutput, output); err != nil {
+			return editResult{}, err
+		}
+	}
+	switch {
+	case gz != nil && result.unchanged:
+		output = content
+	case gz != nil:
+		output, err = gz.compress(output)
+		if err != nil {
+			return editResult{}, fmt.Errorf("compressing file %s: %w", filename, err)
+		}
+	}
+	if opts.printHash {
+		result.sha256 = sha256Hex(output)
+	}
+	if opts.printMatch {
+		writeMatch(os.Stderr, filename, result)
+	}
+	if opts.countLines {
+		result.linesRemoved, result.linesAdded = lineChanges(text, newText)
+	}
+	if opts.emitPatch != "" {
+		var patch strings.Builder
+		writePatch(&patch, filename, text, newText, missing)
+		result.patch = patch.String()
+	}
+
+	// Write the modified content back to the file, leaving it untouched
+	// (including its mtime) when nothing changed. A pipe always gets the
+	// content, since its reader is waiting for it.
+	if !opts.dryRun && (!result.unchanged || pipe) {
+		// Don't start writing once the deadline has passed. A write that
+		// is already under way goes through a temporary file, so it is
+		// never left half done.
+		if err := ctx.Err(); err != nil {
+			return editResult{}, fmt.Errorf("writing file %s: %w", filename, err)
+		}
+		if !missing && (opts.backup || opts.backupKeep > 0 || opts.backupSuffix != "") {
+			suffix := opts.backupSuffix
+			if suffix == "" {
+				suffix = defaultBackupSuffix
+			}
+			if err := writeBackup(filename, content, suffix, opts.backupKeep); err != nil {
+				return editResult{}, fmt.Errorf("backing up file %s: %w", filename, err)
+			}
+		}
+		writeOpts := opts
+		if pipe {
+			// Renaming a temporary file into place would replace the pipe
+			writeOpts.atomic, writeOpts.timeout = false, 0
+		}
+		writeStart := time.Now()
+		err = writeFile(filename, output, writeOpts)
+		if err != nil {
+			return editResult{}, fmt.Errorf("writing file %s: %w", filename, err)
+		}
+		if opts.verbose {
+			writePhaseTime(os.Stderr, filename, "write", time.Since(writeStart))
+		}
+
+		if opts.formatCmd != "" {
+			if err := runFormatter(opts.formatCmd, filename); err != nil {
+				if !opts.formatRollback {
+					return editResult{}, fmt.Errorf("formatting file %s after the edit was written: %w", filename, err)
+				}
+				var rollbackErr error
+				if missing {
+					rollbackErr = os.Remove(filename)
+				} else {
+					rollbackErr = writeFile(filename, content, opts)
+				}
+				if rollbackErr != nil {
+					return editResult{}, fmt.Errorf("rolling back file %s after the formatter failed: %w", filename, rollbackErr)
+				}
+				return editResult{}, fmt.Errorf("formatting file %s failed, so the edit was rolled back: %w", filename, err)
+			}
+		}
 	}
 
-	filename := flag.Arg(0)
+	return result, nil
+}
 
-	// Read diff from stdin
-	diff, err := readDiffFromStdin()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading diff from stdin: %v\n", err)
-		os.Exit(1)
+// writePhaseTime prints how long one phase of processing name took, for
+// --verbose.
+func writePhaseTime(w io.Writer, name, phase string, elapsed time.Duration) {
+	fmt.Fprintf(w, "%s: %s took %s\n", name, phase, elapsed.Round(time.Microsecond))
+}
+
+// fileKind describes the type of a file that is not a regular file.
+func fileKind(mode fs.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "a directory"
+	case mode&fs.ModeSocket != 0:
+		return "a socket"
+	case mode&fs.ModeDevice != 0:
+		return "a device"
 	}
+	return "a special file"
+}
 
-	// Parse the diff
-	searchBlock, replaceBlock, err := parseDiff(diff)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing diff: %v\n", err)
-		os.Exit(1)
+// checkGuards tests the preconditions a file must meet before it is edited
+// and returns why it should be skipped, or "" if it may be edited.
+func checkGuards(content string, opts runOptions) string {
+	if opts.requirePresent != "" && !strings.Contains(content, opts.requirePresent) {
+		return fmt.Sprintf("required text %q not present", opts.requirePresent)
 	}
+	if opts.requireAbsent != "" && strings.Contains(content, opts.requireAbsent) {
+		return fmt.Sprintf("text %q already present", opts.requireAbsent)
+	}
+	return ""
+}
 
-	// Read the file
-	content, err := os.ReadFile(filename)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", filename, err)
-		os.Exit(1)
+// runEdit computes the edit, giving up when ctx is done. The search stops
+// soon after that; anything else the edit still does finishes in the
+// background, and its result is discarded.
+func runEdit(ctx context.Context, edit editFunc, content string) (editResult, error) {
+	if ctx.Done() == nil {
+		return edit(ctx, content)
 	}
 
-	// Perform the edit
-	newContent, err := performEdit(string(content), searchBlock, replaceBlock)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error performing edit: %v\n", err)
-		os.Exit(1)
+	type outcome struct {
+		result editResult
+		err    error
 	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := edit(ctx, content)
+		done <- outcome{result, err}
+	}()
 
-	// Write the modified content back to the file
-	err = os.WriteFile(filename, []byte(newContent), 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing file %s: %v\n", filename, err)
-		os.Exit(1)
+	select {
+	case o := <-done:
+		if ctx.Err() == nil {
+			return o.result, o.err
+		}
+		// The search may have been cut short
+		return editResult{}, fmt.Errorf("timed out: %w", ctx.Err())
+	case <-ctx.Done():
+		return editResult{}, fmt.Errorf("timed out: %w", ctx.Err())
 	}
+}
 
-	fmt.Printf("Successfully applied edit to %s\n", filename)
+var errMatchTimeout = errors.New("match timed out")
+
+// runMatch is runEdit with the edit alone limited to timeout, if it is not 0,
+// failing with errMatchTimeout when that runs out first.
+func runMatch(ctx context.Context, edit editFunc, content string, timeout time.Duration) (editResult, error) {
+	if timeout <= 0 {
+		return runEdit(ctx, edit, content)
+	}
+	matchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := runEdit(matchCtx, edit, content)
+	if err != nil && ctx.Err() == nil && matchCtx.Err() != nil {
+		return editResult{}, fmt.Errorf("%w after %s", errMatchTimeout, timeout)
+	}
+	return result, err
 }
 
-func showExample() {
+// showExample prints usage information. format selects how the example
+// passes the diff: "heredoc" pipes it from a shell heredoc, "file" reads it
+// from a file with -diff.
+func showExample(format string) {
 	fmt.Println("apply-edit - Apply search and replace edits to files")
 	fmt.Println()
 	fmt.Println("USAGE:")
-	fmt.Printf("  %s [--explain] <filename>\n", os.Args[0])
+	fmt.Printf("  %s [options] <filename>\n", os.Args[0])
+	fmt.Println("  Run with -h to list all options.")
 	fmt.Println()
 	fmt.Println("DESCRIPTION:")
-	fmt.Println("  Reads a diff from stdin and applies it to the specified file.")
+	fmt.Println("  Reads a diff from stdin (or the file given with -diff) and applies it")
+	fmt.Println("  to the specified file.")
 	fmt.Println("  The diff uses a special format with SEARCH and REPLACE blocks.")
 	fmt.Println()
 	fmt.Println("EXAMPLE:")
@@ -80,15 +1193,28 @@ func showExample() {
 	fmt.Println("    from flask import Flask")
 	fmt.Println("    app = Flask(__name__)")
 	fmt.Println()
-	fmt.Println("  Run this command:")
-	fmt.Printf("    cat <<EOF | %s app.py\n", os.Args[0])
-	fmt.Println("    <<<<<<< SEARCH")
-	fmt.Println("    from flask import Flask")
-	fmt.Println("    =======")
-	fmt.Println("    import math")
-	fmt.Println("    from flask import Flask")
-	fmt.Println("    >>>>>>> REPLACE")
-	fmt.Println("    EOF")
+	if format == "file" {
+		fmt.Println("  Save this diff as 'patch.txt':")
+		fmt.Println("    <<<<<<< SEARCH")
+		fmt.Println("    from flask import Flask")
+		fmt.Println("    =======")
+		fmt.Println("    import math")
+		fmt.Println("    from flask import Flask")
+		fmt.Println("    >>>>>>> REPLACE")
+		fmt.Println()
+		fmt.Println("  Run this command:")
+		fmt.Printf("    %s -diff patch.txt app.py\n", os.Args[0])
+	} else {
+		fmt.Println("  Run this command:")
+		fmt.Printf("    cat <<EOF | %s app.py\n", os.Args[0])
+		fmt.Println("    <<<<<<< SEARCH")
+		fmt.Println("    from flask import Flask")
+		fmt.Println("    =======")
+		fmt.Println("    import math")
+		fmt.Println("    from flask import Flask")
+		fmt.Println("    >>>>>>> REPLACE")
+		fmt.Println("    EOF")
+	}
 	fmt.Println()
 	fmt.Println("  Result: The file will be updated to:")
 	fmt.Println("    import math")
@@ -106,12 +1232,93 @@ func showExample() {
 	fmt.Println("  - The search text must match exactly (including whitespace)")
 	fmt.Println("  - If multiple matches exist, the operation will fail to avoid ambiguity")
 	fmt.Println("  - Empty replace blocks will delete the search text")
+	fmt.Println("  - {{MATCH}} in the replace block expands to the matched text (\\{{MATCH}} keeps it literal)")
 	fmt.Println("  - The original file is overwritten with the changes")
 }
 
-func readDiffFromStdin() (string, error) {
+// loadDiff returns the diff given with --edit, or reads it like readDiff if
+// there is none.
+func loadDiff(editArg, path string, maxSize int64, stdinTimeout time.Duration) (string, error) {
+	if editArg != "" {
+		return editArg, nil
+	}
+	return readDiff(path, maxSize, stdinTimeout)
+}
+
+// stdinHasInput reports whether stdin is redirected from a non-empty file.
+// A pipe can't be told apart from one that will never be written to, as
+// started by many programs, so it is not counted.
+func stdinHasInput() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode().IsRegular() && info.Size() > 0
+}
+
+// readDiff reads the diff from path, or from stdin when path is empty or "-".
+// A diff of more than maxSize bytes is an error; 0 means no limit. Reading
+// stdin fails with errStdinTimeout if it takes longer than stdinTimeout,
+// unless that is 0.
+func readDiff(path string, maxSize int64, stdinTimeout time.Duration) (string, error) {
+	if path == "" || path == "-" {
+		return readDiffWithin(os.Stdin, maxSize, stdinTimeout)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return readDiffFrom(f, maxSize)
+}
+
+// exitStdinTimeout is the exit code when the diff on stdin did not arrive
+// within --stdin-timeout.
+const exitStdinTimeout = 3
+
+var errStdinTimeout = errors.New("timed out waiting for the diff on stdin")
+
+// readDiffExitCode returns the exit code for an error reading the diff.
+func readDiffExitCode(err error) int {
+	if errors.Is(err, errStdinTimeout) {
+		return exitStdinTimeout
+	}
+	return 1
+}
+
+// readDiffWithin is readDiffFrom giving up after timeout, if it is not 0. The
+// read can't be interrupted, so on timeout it is abandoned; the process is
+// about to exit anyway.
+func readDiffWithin(r io.Reader, maxSize int64, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return readDiffFrom(r, maxSize)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type outcome struct {
+		diff string
+		err  error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		diff, err := readDiffFrom(r, maxSize)
+		done <- outcome{diff, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.diff, o.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("%w after %s", errStdinTimeout, timeout)
+	}
+}
+
+// readDiffFrom reads a diff of at most maxSize bytes from r. It stops as soon
+// as the limit is passed instead of buffering the whole stream.
+func readDiffFrom(r io.Reader, maxSize int64) (string, error) {
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
 	var builder strings.Builder
-	reader := bufio.NewReader(os.Stdin)
+	reader := bufio.NewReader(r)
 
 	for {
 		line, err := reader.ReadString('\n')
@@ -126,62 +1333,749 @@ func readDiffFromStdin() (string, error) {
 		}
 		builder.WriteString(line)
 	}
+	if maxSize > 0 && int64(builder.Len()) > maxSize {
+		return "", fmt.Errorf("diff is larger than the --max-diff-size of %s", sizeValue(maxSize))
+	}
 
 	return builder.String(), nil
 }
 
+// readBlockFile reads a search or replace block from a file. Line endings are
+// normalized and the final line break is dropped, the same as for a block
+// inside a diff.
+func readBlockFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(normalize(string(data)), "\n"), nil
+}
+
+// loadBlocks returns the blocks to apply, taken from the diff and the
+// --search-from and --replace-from files. The search and the replace text
+// must each come from exactly one of them. Without --search-from the diff may
+// have several blocks; with it, the diff only provides the replace block (or
+// is the replacement verbatim if it has no markers) unless --replace-from is
+// also given, in which case it is not used at all.
+func loadBlocks(diff, searchFrom, replaceFrom string, opts parseOptions) ([]diffBlock, error) {
+	if searchFrom == "" {
+		blocks, err := parseBlocks(diff, opts)
+		if err != nil || replaceFrom == "" {
+			return blocks, err
+		}
+		return replaceFromFile(blocks, replaceFrom)
+	}
+
+	searchBlock, err := readBlockFile(searchFrom)
+	if err != nil {
+		return nil, err
+	}
+	if searchBlock == "" {
+		return nil, fmt.Errorf("--search-from file %s is empty", searchFrom)
+	}
+
+	var replaceBlock string
+	if replaceFrom != "" {
+		replaceBlock, err = readBlockFile(replaceFrom)
+	} else {
+		var searchLines []string
+		searchLines, _, _, err = scanDiff(diff, opts)
+		if err == nil && len(searchLines) > 0 {
+			return nil, errors.New("the diff has a search block as well as --search-from")
+		}
+		if err == nil {
+			replaceBlock, err = parseReplaceBlock(diff, opts)
+		}
+	}
+	if err == nil && opts.reverse {
+		searchBlock, replaceBlock, err = reverseBlock(searchBlock, replaceBlock)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []diffBlock{{searchBlock, replaceBlock}}, nil
+}
+
+// replaceFromFile sets the replace block of a single-block diff to the
+// contents of path. The diff must not have a replace block of its own.
+func replaceFromFile(blocks []diffBlock, path string) ([]diffBlock, error) {
+	if len(blocks) != 1 {
+		return nil, errors.New("--replace-from needs a diff with a single block")
+	}
+	if blocks[0].replace != "" {
+		return nil, errors.New("the diff has a replace block as well as --replace-from")
+	}
+	replaceBlock, err := readBlockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []diffBlock{{blocks[0].search, replaceBlock}}, nil
+}
+
+// diffBlock is one search and replace pair of a diff.
+type diffBlock struct {
+	search, replace string
+}
+
+// parseBlocks splits diff into its search and replace blocks. A new block
+// starts at every SEARCH marker; a diff with at most one of them is parsed
+// exactly like parseDiffWith.
+func parseBlocks(diff string, opts parseOptions) ([]diffBlock, error) {
+	lines := strings.Split(diff, "\n")
+	var starts []int
+	fence := 0
+	for i, line := range lines {
+		if n, ok := opensBlock(line, fence); ok {
+			starts = append(starts, i)
+			fence = n
+		} else if isReplaceMarker(line, fence) {
+			fence = 0
+		}
+	}
+	if len(starts) <= 1 {
+		searchBlock, replaceBlock, err := parseDiffWith(diff, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []diffBlock{{searchBlock, replaceBlock}}, nil
+	}
+
+	// Check the marker order across the whole diff, which the blocks on
+	// their own can't see
+	if _, _, _, err := scanDiff(diff, opts); err != nil {
+		return nil, err
+	}
+
+	// Anything before the first marker stays with the first block, where
+	// it is ignored like in a single-block diff
+	starts[0] = 0
+	blocks := make([]diffBlock, len(starts))
+	for i, start := range starts {
+		end := len(lines)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		searchBlock, replaceBlock, err := parseDiffWith(strings.Join(lines[start:end], "\n"), opts)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i+1, err)
+		}
+		blocks[i] = diffBlock{searchBlock, replaceBlock}
+	}
+	if opts.reverse {
+		// Undo the blocks in the opposite order they were applied in
+		slices.Reverse(blocks)
+	}
+	return blocks, nil
+}
+
 func parseDiff(diff string) (searchBlock, replaceBlock string, err error) {
-	lines := strings.Split(strings.TrimSpace(diff), "\n")
+	return parseDiffWith(diff, parseOptions{})
+}
+
+// parseOptions controls how a diff is parsed.
+type parseOptions struct {
+	// noTrim keeps leading and trailing whitespace of the whole diff
+	// instead of trimming it before parsing.
+	noTrim bool
+	// reverse swaps the search and replace blocks, undoing the diff.
+	reverse bool
+	// markerEscape, if set, is a prefix that makes a marker line content
+	// of the block. It is stripped once from such lines.
+	markerEscape string
+}
+
+func parseDiffWith(diff string, opts parseOptions) (searchBlock, replaceBlock string, err error) {
+	searchLines, replaceLines, _, err := scanDiff(diff, opts)
+	if err != nil {
+		return "", "", err
+	}
+	
+	if len(searchLines) == 0 {
+		return "", "", fmt.Errorf("no search block found in diff")
+	}
+	
+	searchBlock = strings.Join(searchLines, "\n")
+	replaceBlock = strings.Join(replaceLines, "\n")
+	if opts.reverse {
+		return reverseBlock(searchBlock, replaceBlock)
+	}
+	
+	return searchBlock, replaceBlock, nil
+}
+
+// reverseBlock swaps a search and replace block so that applying them undoes
+// the original edit. A deletion can't be undone since nothing is left to
+// search for.
+func reverseBlock(searchBlock, replaceBlock string) (string, string, error) {
+	if replaceBlock == "" {
+		return "", "", errors.New("cannot reverse a diff with an empty replace block")
+	}
+	return replaceBlock, searchBlock, nil
+}
+
+// parseReplaceBlock returns the replace block of diff for modes that do not
+// search. Input without any markers is taken verbatim as the replacement.
+func parseReplaceBlock(diff string, opts parseOptions) (string, error) {
+	_, replaceLines, hasMarkers, err := scanDiff(diff, opts)
+	if err != nil {
+		return "", err
+	}
+	if !hasMarkers {
+		return diff, nil
+	}
+	return strings.Join(replaceLines, "\n"), nil
+}
+
+// scanDiff splits diff into the lines of its search and replace blocks and
+// reports whether any markers were seen. A divider or REPLACE marker that
+// comes before a SEARCH marker, or a REPLACE marker before the divider, is an
+// error rather than being silently misread.
+func scanDiff(diff string, opts parseOptions) (searchLines, replaceLines []string, hasMarkers bool, err error) {
+	// firstLine is the line number of the first line after trimming, so
+	// that errors can refer to lines of the diff as given
+	firstLine := 1
+	if opts.noTrim {
+		// Only drop the newline terminating the last line
+		diff = strings.TrimSuffix(diff, "\n")
+	} else {
+		firstLine += strings.Count(diff[:len(diff)-len(strings.TrimLeftFunc(diff, unicode.IsSpace))], "\n")
+		diff = strings.TrimSpace(diff)
+	}
+	lines := strings.Split(diff, "\n")
+
+	lastSearch := -1
+	for i, line := range lines {
+		if searchMarker(line) > 0 {
+			lastSearch = i
+		}
+	}
 	
-	var searchLines, replaceLines []string
 	var inSearch, inReplace bool
+	// fence is the marker length of the current block, 0 outside blocks
+	fence := 0
 	
-	for _, line := range lines {
+	for i, line := range lines {
+		n, opens := opensBlock(line, fence)
 		switch {
-		case strings.HasPrefix(line, "<<<<<<< SEARCH"):
+		case opens:
 			inSearch = true
 			inReplace = false
-		case strings.HasPrefix(line, "======="):
+			hasMarkers = true
+			fence = n
+		case isDivider(line, fence):
+			if !inSearch && !inReplace && i < lastSearch {
+				return nil, nil, true, fmt.Errorf("markers out of order: ======= on line %d comes before <<<<<<< SEARCH", firstLine+i)
+			}
 			inSearch = false
 			inReplace = true
-		case strings.HasPrefix(line, ">>>>>>> REPLACE"):
+			hasMarkers = true
+		case isReplaceMarker(line, fence):
+			if inSearch {
+				return nil, nil, true, fmt.Errorf("markers out of order: >>>>>>> REPLACE on line %d comes before =======", firstLine+i)
+			}
+			if !inReplace && i < lastSearch {
+				return nil, nil, true, fmt.Errorf("markers out of order: >>>>>>> REPLACE on line %d comes before <<<<<<< SEARCH", firstLine+i)
+			}
 			inSearch = false
 			inReplace = false
+			hasMarkers = true
+			fence = 0
 		case inSearch:
-			searchLines = append(searchLines, line)
+			searchLines = append(searchLines, unescapeMarker(line, opts.markerEscape))
 		case inReplace:
-			replaceLines = append(replaceLines, line)
+			replaceLines = append(replaceLines, unescapeMarker(line, opts.markerEscape))
 		}
 	}
 	
-	if len(searchLines) == 0 {
-		return "", "", fmt.Errorf("no search block found in diff")
+	return searchLines, replaceLines, hasMarkers, nil
+}
+
+// formatDiff renders a search and replace block in the canonical diff format,
+// with longer markers if the blocks contain lines that look like markers.
+func formatDiff(searchBlock, replaceBlock string) string {
+	fence := blockFence(searchBlock, replaceBlock)
+	var builder strings.Builder
+	builder.WriteString(strings.Repeat("<", fence) + " SEARCH\n")
+	builder.WriteString(searchBlock)
+	builder.WriteString("\n" + strings.Repeat("=", fence) + "\n")
+	if replaceBlock != "" {
+		builder.WriteString(replaceBlock)
+		builder.WriteString("\n")
 	}
-	
-	searchBlock = strings.Join(searchLines, "\n")
-	replaceBlock = strings.Join(replaceLines, "\n")
-	
-	return searchBlock, replaceBlock, nil
+	builder.WriteString(strings.Repeat(">", fence) + " REPLACE\n")
+	return builder.String()
 }
 
 func performEdit(content, searchBlock, replaceBlock string) (string, error) {
+	result, err := applyEdit(content, searchBlock, replaceBlock, editOptions{})
+	if err != nil {
+		return "", err
+	}
+	return result.content, nil
+}
+
+var (
+	errSearchNotFound = errors.New("search block not found")
+	errAmbiguous      = errors.New("multiple occurrences of search block found")
+	errDeclined       = errors.New("declined")
+)
+
+// editOptions controls how the search block is matched against the file.
+type editOptions struct {
+	ignoreEOLWhitespace bool
+	// ctx, when set, stops a search early once it is done. The result is
+	// then meaningless and must be discarded.
+	ctx context.Context
+	// fuzz is the number of lines of the search block that may differ
+	// from the file when no exact match exists.
+	fuzz int
+	// wholeLines rejects matches that start or end in the middle of a line.
+	wholeLines bool
+	// lineAnchored only counts matches that start at the beginning of a
+	// line and end at the end of one, unlike wholeLines which fails on a
+	// match that doesn't.
+	lineAnchored bool
+	// wholeWord only counts matches that are not part of a longer word.
+	wholeWord bool
+	// preserveCase matches regardless of case and gives the replacement
+	// the capitalization of the matched text when that is ALL CAPS or
+	// title case.
+	preserveCase bool
+	// contextBefore and contextAfter are lines that must immediately
+	// precede or follow an occurrence for it to count as a match.
+	contextBefore string
+	contextAfter  string
+	// trailingContextCount, when set, makes contextAfter, which must have
+	// that many lines, a check on the chosen match instead of a filter.
+	trailingContextCount int
+	// equivalentIndent treats tabs and spaces in indentation as equal when
+	// they reach the same column, with tab stops every tabWidth columns.
+	equivalentIndent bool
+	tabWidth         int
+	// idempotent treats an edit whose replace block is already present in
+	// place of a missing search block as already applied.
+	idempotent bool
+	// comments, when set, is the syntax of comments to ignore when
+	// matching.
+	comments *commentSyntax
+	// matchReport lists every candidate region when a match is ambiguous.
+	matchReport bool
+	// noNormalize matches and writes the content byte for byte, without
+	// converting CRLF line endings to LF.
+	noNormalize bool
+	// tolerateBlankLines ignores blank lines added or removed inside a
+	// block when matching.
+	tolerateBlankLines bool
+	// anchorFirstLine lets the first line of the search block match at a
+	// different indentation when the block doesn't match as given.
+	anchorFirstLine bool
+	// uniqueAnchor resolves an ambiguous match by the file context around
+	// the occurrences, when that singles one of them out.
+	uniqueAnchor bool
+	// occurrenceHash, if set, is a prefix of the occurrenceHash of the one
+	// occurrence to edit.
+	occurrenceHash string
+	// wildcardLine, if set, is the text of a search block line that
+	// matches any number of lines.
+	wildcardLine string
+	// trailingNewline is whether a line break after the last line of the
+	// search block is part of what must match.
+	trailingNewline trailingNewlineMode
+}
+
+// trailingNewlineMode controls whether the line break after the last line of
+// a search block is significant when matching.
+type trailingNewlineMode int
+
+const (
+	// trailingNewlineStrip matches the search block as parsed, so its
+	// last line may be followed by anything.
+	trailingNewlineStrip trailingNewlineMode = iota
+	// trailingNewlineKeep requires a line break after the last line.
+	trailingNewlineKeep
+	// trailingNewlineAuto uses the line break if the search block then
+	// matches exactly once, and matches as parsed otherwise.
+	trailingNewlineAuto
+)
+
+// parseTrailingNewline parses the value of --search-trailing-newline.
+func parseTrailingNewline(s string) (trailingNewlineMode, error) {
+	switch s {
+	case "strip":
+		return trailingNewlineStrip, nil
+	case "keep":
+		return trailingNewlineKeep, nil
+	case "auto":
+		return trailingNewlineAuto, nil
+	}
+	return 0, fmt.Errorf("unknown --search-trailing-newline %q (want keep, strip or auto)", s)
+}
+
+// defaultTabWidth is the tab stop used when none is configured.
+const defaultTabWidth = 4
+
+// tabStop returns the configured tab width, falling back to the default.
+func (o editOptions) tabStop() int {
+	if o.tabWidth <= 0 {
+		return defaultTabWidth
+	}
+	return o.tabWidth
+}
+
+// editResult describes a successful edit. Offsets refer to the normalized
+// original content.
+type editResult struct {
+	original    string
+	content     string
+	start, end  int
+	replacement string
+	// unchanged is set when the edit leaves the file exactly as it was.
+	unchanged bool
+	// skipped is why the file was not edited at all because it failed a
+	// precondition, or "" if the edit was attempted.
+	skipped string
+	// sha256 is the hex SHA-256 of the resulting file content, set with
+	// --print-hash.
+	sha256 string
+	// patch is the change as a unified diff, set with --emit-patch.
+	patch string
+	// linesRemoved and linesAdded count the lines that changed, set with
+	// --count-lines-changed.
+	linesRemoved, linesAdded int
+	// blocks holds the outcome of each block of a multi-block diff in
+	// order. It is nil for single-block edits.
+	blocks []blockOutcome
+	// notes are remarks about how the edit was made, such as how an
+	// ambiguous match was resolved, to pass on to the user.
+	notes []string
+}
+
+// blockOutcome is the result of applying one block of a multi-block diff.
+// err is set if the block was skipped.
+type blockOutcome struct {
+	err error
+}
+
+// skippedBlocks returns the 1-based numbers of the blocks that were skipped.
+func (r editResult) skippedBlocks() []int {
+	var skipped []int
+	for i, block := range r.blocks {
+		if block.err != nil {
+			skipped = append(skipped, i+1)
+		}
+	}
+	return skipped
+}
+
+func applyEdit(content, searchBlock, replaceBlock string, opts editOptions) (editResult, error) {
 	// Handle the case where search block might have different line endings
-	normalizedContent := strings.ReplaceAll(content, "\r\n", "\n")
-	normalizedSearch := strings.ReplaceAll(searchBlock, "\r\n", "\n")
+	normalizedContent := normalizeWith(content, opts)
+	normalizedSearch := normalizeWith(searchBlock, opts)
+	opts.contextBefore = normalizeWith(opts.contextBefore, opts)
+	opts.contextAfter = normalizeWith(opts.contextAfter, opts)
+	var trailingContext string
+	if opts.trailingContextCount > 0 {
+		trailingContext, opts.contextAfter = opts.contextAfter, ""
+	}
+
+	if opts.anchorFirstLine {
+		indent, count := anchorIndent(normalizedContent, normalizedSearch, opts)
+		if count > 1 {
+			return editResult{}, fmt.Errorf("%w - the first line matches at several indentations", errAmbiguous)
+		}
+		if count == 1 {
+			normalizedSearch = reindentFirstLine(normalizedSearch, normalizedSearch, indent)
+			replaceBlock = reindentFirstLine(replaceBlock, searchBlock, indent)
+		}
+	}
 	
+	if opts.trailingNewline != trailingNewlineStrip && normalizedSearch != "" && !strings.HasSuffix(normalizedSearch, "\n") {
+		withNewline := opts.trailingNewline == trailingNewlineKeep
+		if !withNewline {
+			_, _, count := findMatch(normalizedContent, normalizedSearch+"\n", opts)
+			withNewline = count == 1
+		}
+		if withNewline {
+			// The line break is matched, so put it back after the
+			// replacement to leave the result as without it
+			normalizedSearch += "\n"
+			replaceBlock += "\n"
+		}
+	}
+
 	// Find the search block in the content
-	index := strings.Index(normalizedContent, normalizedSearch)
-	if index == -1 {
-		return "", fmt.Errorf("search block not found in file:\n%s", searchBlock)
+	start, end, count := findMatch(normalizedContent, normalizedSearch, opts)
+	if count == 0 {
+		if opts.idempotent {
+			if result, ok := alreadyApplied(normalizedContent, replaceBlock, opts); ok {
+				return result, nil
+			}
+		}
+		if normalizedContent == "" {
+			return editResult{}, fmt.Errorf("%w: file is empty", errSearchNotFound)
+		}
+		if matchesIgnoringCR(normalizedContent, normalizedSearch) {
+			return editResult{}, fmt.Errorf("%w in file:\n%s\nhint: the search block matches after line-ending normalization - check your CRLF handling", errSearchNotFound, searchBlock)
+		}
+		return editResult{}, fmt.Errorf("%w in file:\n%s", errSearchNotFound, searchBlock)
 	}
 	
+	var notes []string
+	switch {
+	case opts.occurrenceHash != "" && normalizedSearch != "":
+		m, err := pickByHash(normalizedContent, findMatches(normalizedContent, normalizedSearch, opts), opts.occurrenceHash)
+		if err != nil {
+			return editResult{}, err
+		}
+		start, end, count = m.start, m.end, 1
+	case count > 1 && opts.uniqueAnchor && normalizedSearch != "":
+		matches := findMatches(normalizedContent, normalizedSearch, opts)
+		if m, width, ok := uniqueAnchor(normalizedContent, matches); ok {
+			start, end, count = m.start, m.end, 1
+			notes = append(notes, anchorNote(normalizedContent, m, width, len(matches)))
+		}
+	}
+
 	// Check if there are multiple occurrences
-	if strings.Index(normalizedContent[index+len(normalizedSearch):], normalizedSearch) != -1 {
-		return "", fmt.Errorf("multiple occurrences of search block found - edit would be ambiguous")
+	if count > 1 {
+		err := fmt.Errorf("%w - edit would be ambiguous", errAmbiguous)
+		matches := findMatches(normalizedContent, normalizedSearch, opts)
+		if opts.matchReport {
+			err = fmt.Errorf("%w\n%s", err, matchReport(normalizedContent, normalizedSearch, opts))
+		} else if len(matches) > 0 {
+			err = fmt.Errorf("%w\n%s", err, occurrenceList(normalizedContent, matches))
+		}
+		return editResult{}, withCandidates(err, normalizedContent, matches)
+	}
+
+	if opts.wholeLines && !isWholeLines(normalizedContent, start, end) {
+		line := strings.Count(normalizedContent[:start], "\n") + 1
+		return editResult{}, fmt.Errorf("match on line %d does not span whole lines", line)
+	}
+	if opts.trailingContextCount > 0 {
+		if err := checkTrailingContext(normalizedContent, end, trailingContext, opts.trailingContextCount); err != nil {
+			return editResult{}, err
+		}
 	}
 	
 	// Perform the replacement
-	newContent := normalizedContent[:index] + replaceBlock + normalizedContent[index+len(normalizedSearch):]
+	matched := normalizedContent[start:end]
+	replacement := expandMatchPlaceholder(replaceBlock, matched)
+	if opts.preserveCase {
+		replacement = matchCase(replacement, matched)
+	}
+	newContent := normalizedContent[:start] + replacement + normalizedContent[end:]
 	
-	return newContent, nil
+	return editResult{
+		original:    normalizedContent,
+		content:     newContent,
+		start:       start,
+		end:         end,
+		replacement: replacement,
+		notes:       notes,
+	}, nil
+}
+
+// appendBlock adds the replace block to the end of the file.
+func appendBlock(replaceBlock string) editFunc {
+	return func(_ context.Context, content string) (editResult, error) {
+		return applyAppend(content, replaceBlock), nil
+	}
+}
+
+// applyAppend appends replaceBlock to content on a line of its own. If the
+// content ends with a newline, so does the result. A leading newline in the
+// block already separates it from an unterminated last line, so none is added
+// then; after a terminated line it is kept and leaves a blank line.
+func applyAppend(content, replaceBlock string) editResult {
+	normalizedContent := normalize(content)
+	replacement := normalize(replaceBlock)
+
+	if normalizedContent != "" && !strings.HasSuffix(normalizedContent, "\n") && !strings.HasPrefix(replacement, "\n") {
+		replacement = "\n" + replacement
+	}
+	if strings.HasSuffix(normalizedContent, "\n") && !strings.HasSuffix(replacement, "\n") {
+		replacement += "\n"
+	}
+
+	end := len(normalizedContent)
+	return editResult{
+		original:    normalizedContent,
+		content:     normalizedContent + replacement,
+		start:       end,
+		end:         end,
+		replacement: replacement,
+	}
+}
+
+// prependBlock inserts the replace block at the start of the file.
+func prependBlock(replaceBlock string) editFunc {
+	return func(_ context.Context, content string) (editResult, error) {
+		return applyPrepend(content, replaceBlock), nil
+	}
+}
+
+// utf8BOM is the byte order mark some editors put at the start of UTF-8 files.
+const utf8BOM = "\uFEFF"
+
+// applyPrepend inserts replaceBlock on its own line(s) at the start of
+// content, after the byte order mark if there is one.
+func applyPrepend(content, replaceBlock string) editResult {
+	normalizedContent := normalize(content)
+	replacement := normalize(replaceBlock)
+
+	start := 0
+	if strings.HasPrefix(normalizedContent, utf8BOM) {
+		start = len(utf8BOM)
+	}
+	if len(normalizedContent) > start && !strings.HasSuffix(replacement, "\n") {
+		replacement += "\n"
+	}
+
+	return editResult{
+		original:    normalizedContent,
+		content:     normalizedContent[:start] + replacement + normalizedContent[start:],
+		start:       start,
+		end:         start,
+		replacement: replacement,
+	}
+}
+
+// countTrue returns how many of the conditions hold.
+func countTrue(conditions ...bool) int {
+	n := 0
+	for _, c := range conditions {
+		if c {
+			n++
+		}
+	}
+	return n
+}
+
+// parsePosition parses a 1-based LINE:COL position.
+func parsePosition(s string) (line, col int, err error) {
+	lineText, colText, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("position %q is not in LINE:COL form", s)
+	}
+	line, err = strconv.Atoi(lineText)
+	if err != nil || line < 1 {
+		return 0, 0, fmt.Errorf("invalid line %q", lineText)
+	}
+	col, err = strconv.Atoi(colText)
+	if err != nil || col < 1 {
+		return 0, 0, fmt.Errorf("invalid column %q", colText)
+	}
+	return line, col, nil
+}
+
+// replaceAt edits length bytes at the 1-based line and byte column.
+func replaceAt(line, col, length int, replaceBlock string) editFunc {
+	return func(_ context.Context, content string) (editResult, error) {
+		return applyEditAt(content, line, col, length, replaceBlock)
+	}
+}
+
+func applyEditAt(content string, line, col, length int, replaceBlock string) (editResult, error) {
+	normalizedContent := normalize(content)
+
+	lines := strings.Split(normalizedContent, "\n")
+	if line > len(lines) {
+		return editResult{}, fmt.Errorf("line %d is past the end of the file (%d lines)", line, len(lines))
+	}
+	if col > len(lines[line-1])+1 {
+		return editResult{}, fmt.Errorf("column %d is past the end of line %d (%d bytes)", col, line, len(lines[line-1]))
+	}
+
+	start := col - 1
+	for _, l := range lines[:line-1] {
+		start += len(l) + 1
+	}
+	end := start + length
+	if length < 0 || end > len(normalizedContent) {
+		return editResult{}, fmt.Errorf("length %d at %d:%d is outside the file", length, line, col)
+	}
+
+	replacement := expandMatchPlaceholder(replaceBlock, normalizedContent[start:end])
+	return editResult{
+		original:    normalizedContent,
+		content:     normalizedContent[:start] + replacement + normalizedContent[end:],
+		start:       start,
+		end:         end,
+		replacement: replacement,
+	}, nil
+}
+
+// matchesIgnoringCR reports whether search occurs in content once carriage
+// returns are either dropped or treated as line breaks, which points at
+// mismatched line endings (e.g. lone CRs that CRLF normalization does not
+// cover).
+func matchesIgnoringCR(content, search string) bool {
+	if !strings.Contains(content, "\r") && !strings.Contains(search, "\r") {
+		return false
+	}
+	for _, r := range []*strings.Replacer{
+		strings.NewReplacer("\r", ""),
+		strings.NewReplacer("\r\n", "\n", "\r", "\n"),
+	} {
+		if strings.Contains(r.Replace(content), r.Replace(search)) {
+			return true
+		}
+	}
+	return false
+}
+
+// alreadyApplied checks whether the replace block occurs exactly once in
+// content, meaning the edit was most likely applied before. The result
+// leaves the content untouched.
+func alreadyApplied(content, replaceBlock string, opts editOptions) (editResult, bool) {
+	replaceBlock = normalizeWith(replaceBlock, opts)
+	if replaceBlock == "" {
+		return editResult{}, false
+	}
+
+	opts.fuzz = 0
+	start, end, count := findMatch(content, replaceBlock, opts)
+	if count != 1 {
+		return editResult{}, false
+	}
+	return editResult{
+		original:    content,
+		content:     content,
+		start:       start,
+		end:         end,
+		replacement: content[start:end],
+	}, true
+}
+
+// isWholeLines reports whether [start, end) begins at the start of a line and
+// ends at the end of one.
+func isWholeLines(content string, start, end int) bool {
+	startsLine := start == 0 || content[start-1] == '\n'
+	endsLine := end == len(content) || content[end] == '\n' || (end > start && content[end-1] == '\n')
+	return startsLine && endsLine
+}
+
+// matchPlaceholder in a replace block expands to the text that was matched.
+// Prefixing it with a backslash keeps it literal.
+const matchPlaceholder = "{{MATCH}}"
+
+func expandMatchPlaceholder(replaceBlock, matched string) string {
+	var builder strings.Builder
+	for {
+		i := strings.Index(replaceBlock, matchPlaceholder)
+		if i == -1 {
+			builder.WriteString(replaceBlock)
+			break
+		}
+		if i > 0 && replaceBlock[i-1] == '\\' {
+			builder.WriteString(replaceBlock[:i-1])
+			builder.WriteString(matchPlaceholder)
+		} else {
+			builder.WriteString(replaceBlock[:i])
+			builder.WriteString(matched)
+		}
+		replaceBlock = replaceBlock[i+len(matchPlaceholder):]
+	}
+	return builder.String()
 }
@@ -1,8 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseDiff(t *testing.T) {
@@ -146,6 +157,413 @@ replacement
 	}
 }
 
+func TestParseDiffNoTrim(t *testing.T) {
+	tests := []struct {
+		name        string
+		diff        string
+		wantSearch  string
+		wantReplace string
+	}{
+		{
+			name:        "trailing blank lines without closing marker",
+			diff:        "<<<<<<< SEARCH\nold\n=======\nnew\n\n\n",
+			wantSearch:  "old",
+			wantReplace: "new\n\n",
+		},
+		{
+			name:        "trailing blank lines of unterminated search",
+			diff:        "<<<<<<< SEARCH\nold\n\n",
+			wantSearch:  "old\n",
+			wantReplace: "",
+		},
+		{
+			name:        "complete diff is unaffected",
+			diff:        "\n<<<<<<< SEARCH\n\nold\n=======\nnew\n>>>>>>> REPLACE\n\n",
+			wantSearch:  "\nold",
+			wantReplace: "new",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSearch, gotReplace, err := parseDiffWith(tt.diff, parseOptions{noTrim: true})
+			if err != nil {
+				t.Fatalf("parseDiffWith() error = %v", err)
+			}
+			if gotSearch != tt.wantSearch {
+				t.Errorf("parseDiffWith() gotSearch = %q, want %q", gotSearch, tt.wantSearch)
+			}
+			if gotReplace != tt.wantReplace {
+				t.Errorf("parseDiffWith() gotReplace = %q, want %q", gotReplace, tt.wantReplace)
+			}
+		})
+	}
+}
+
+func TestParseDiffMarkerOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		diff    string
+		wantErr string
+	}{
+		{
+			name: "search divider replace",
+			diff: "<<<<<<< SEARCH\na\n=======\nb\n>>>>>>> REPLACE",
+		},
+		{
+			name:    "search replace divider",
+			diff:    "<<<<<<< SEARCH\na\n>>>>>>> REPLACE\nb\n=======",
+			wantErr: ">>>>>>> REPLACE on line 3 comes before =======",
+		},
+		{
+			name:    "divider search replace",
+			diff:    "=======\na\n<<<<<<< SEARCH\nb\n>>>>>>> REPLACE",
+			wantErr: "======= on line 1 comes before <<<<<<< SEARCH",
+		},
+		{
+			name:    "divider replace search",
+			diff:    "=======\na\n>>>>>>> REPLACE\n<<<<<<< SEARCH\nb",
+			wantErr: "======= on line 1 comes before <<<<<<< SEARCH",
+		},
+		{
+			name:    "replace search divider",
+			diff:    ">>>>>>> REPLACE\na\n<<<<<<< SEARCH\nb\n=======",
+			wantErr: ">>>>>>> REPLACE on line 1 comes before <<<<<<< SEARCH",
+		},
+		{
+			name:    "replace divider search",
+			diff:    ">>>>>>> REPLACE\na\n=======\n<<<<<<< SEARCH\nb",
+			wantErr: ">>>>>>> REPLACE on line 1 comes before <<<<<<< SEARCH",
+		},
+		{
+			name:    "line numbers count trimmed lines",
+			diff:    "\n\n<<<<<<< SEARCH\na\n>>>>>>> REPLACE\n",
+			wantErr: ">>>>>>> REPLACE on line 5 comes before =======",
+		},
+		{
+			name:    "stray divider between blocks",
+			diff:    "<<<<<<< SEARCH\na\n=======\nb\n>>>>>>> REPLACE\n=======\n<<<<<<< SEARCH\nc\n=======\nd\n>>>>>>> REPLACE",
+			wantErr: "======= on line 6 comes before <<<<<<< SEARCH",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseBlocks(tt.diff, parseOptions{})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("parseBlocks() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseBlocks() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseBlocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		diff    string
+		opts    parseOptions
+		want    []diffBlock
+		wantErr string
+	}{
+		{
+			name: "single block",
+			diff: "<<<<<<< SEARCH\nold\n=======\nnew\n>>>>>>> REPLACE",
+			want: []diffBlock{{"old", "new"}},
+		},
+		{
+			name: "several blocks with noise",
+			diff: "Some explanation\n<<<<<<< SEARCH\na\n=======\nA\n>>>>>>> REPLACE\n\nand then\n<<<<<<< SEARCH\nb\n=======\n>>>>>>> REPLACE\n",
+			want: []diffBlock{{"a", "A"}, {"b", ""}},
+		},
+		{
+			name:    "empty second block",
+			diff:    "<<<<<<< SEARCH\na\n=======\nA\n>>>>>>> REPLACE\n<<<<<<< SEARCH\n=======\nB\n>>>>>>> REPLACE",
+			wantErr: "block 2: no search block found",
+		},
+		{
+			name: "reversed",
+			diff: "<<<<<<< SEARCH\na\n=======\nA\n>>>>>>> REPLACE\n<<<<<<< SEARCH\nA\n=======\nAA\n>>>>>>> REPLACE",
+			opts: parseOptions{reverse: true},
+			want: []diffBlock{{"AA", "A"}, {"A", "a"}},
+		},
+		{
+			name:    "reversed deletion",
+			diff:    "<<<<<<< SEARCH\nold\n=======\n>>>>>>> REPLACE",
+			opts:    parseOptions{reverse: true},
+			wantErr: "cannot reverse a diff with an empty replace block",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBlocks(tt.diff, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseBlocks() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBlocks() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBlocks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replacement.txt")
+	if err := os.WriteFile(path, []byte("line one\r\nline two\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := replaceFromFile([]diffBlock{{search: "old"}}, path)
+	if err != nil {
+		t.Fatalf("replaceFromFile() error = %v", err)
+	}
+	if want := []diffBlock{{"old", "line one\nline two"}}; !reflect.DeepEqual(blocks, want) {
+		t.Errorf("replaceFromFile() = %q, want %q", blocks, want)
+	}
+
+	if _, err := replaceFromFile([]diffBlock{{"old", "new"}}, path); err == nil {
+		t.Error("replaceFromFile() with a replace block in the diff succeeded")
+	}
+	if _, err := replaceFromFile([]diffBlock{{search: "a"}, {search: "b"}}, path); err == nil {
+		t.Error("replaceFromFile() with several blocks succeeded")
+	}
+}
+
+func TestLoadBlocks(t *testing.T) {
+	dir := t.TempDir()
+	searchFile := filepath.Join(dir, "search.txt")
+	replaceFile := filepath.Join(dir, "replace.txt")
+	if err := os.WriteFile(searchFile, []byte("<<<<<<< SEARCH\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(replaceFile, []byte("<<<<<<< HEAD\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		diff        string
+		searchFrom  string
+		replaceFrom string
+		want        []diffBlock
+		wantErr     string
+	}{
+		{
+			name: "diff only",
+			diff: "<<<<<<< SEARCH\na\n=======\nb\n>>>>>>> REPLACE",
+			want: []diffBlock{{"a", "b"}},
+		},
+		{
+			name:        "both from files",
+			searchFrom:  searchFile,
+			replaceFrom: replaceFile,
+			want:        []diffBlock{{"<<<<<<< SEARCH", "<<<<<<< HEAD"}},
+		},
+		{
+			name:       "replace block from diff",
+			diff:       "=======\nb\n>>>>>>> REPLACE",
+			searchFrom: searchFile,
+			want:       []diffBlock{{"<<<<<<< SEARCH", "b"}},
+		},
+		{
+			name:       "replacement verbatim",
+			diff:       "plain text\n",
+			searchFrom: searchFile,
+			want:       []diffBlock{{"<<<<<<< SEARCH", "plain text\n"}},
+		},
+		{
+			name:       "search in both",
+			diff:       "<<<<<<< SEARCH\na\n=======\nb\n>>>>>>> REPLACE",
+			searchFrom: searchFile,
+			wantErr:    "as well as --search-from",
+		},
+		{
+			name:       "missing file",
+			searchFrom: filepath.Join(dir, "missing.txt"),
+			wantErr:    "missing.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadBlocks(tt.diff, tt.searchFrom, tt.replaceFrom, parseOptions{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadBlocks() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadBlocks() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadBlocks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchReplaceBlocks(t *testing.T) {
+	blocks := []diffBlock{
+		{"one", "ONE"},
+		{"missing", "MISSING"},
+		{"three\n", "3\n33\n"},
+	}
+	content := "one\ntwo\nthree\n"
+
+	if _, err := searchReplaceBlocks(blocks, editOptions{}, false)(context.Background(), content); !errors.Is(err, errSearchNotFound) || !strings.Contains(err.Error(), "block 2") {
+		t.Errorf("without best effort: error = %v, want block 2 not found", err)
+	}
+
+	result, err := searchReplaceBlocks(blocks, editOptions{}, true)(context.Background(), content)
+	if err != nil {
+		t.Fatalf("with best effort: error = %v", err)
+	}
+	if want := "ONE\ntwo\n3\n33\n"; result.content != want {
+		t.Errorf("content = %q, want %q", result.content, want)
+	}
+	if got := result.skippedBlocks(); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("skippedBlocks() = %v, want [2]", got)
+	}
+	if got := result.original[:result.start] + result.replacement + result.original[result.end:]; got != result.content {
+		t.Errorf("changed region does not reproduce the content: %q", got)
+	}
+
+	_, err = searchReplaceBlocks([]diffBlock{{"x", "y"}, {"z", "w"}}, editOptions{}, true)(context.Background(), content)
+	if !errors.Is(err, errSearchNotFound) {
+		t.Errorf("no block applies: error = %v, want errSearchNotFound", err)
+	}
+}
+
+func TestSearchReplaceBlocksShiftingOffsets(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		blocks  []diffBlock
+		want    string
+	}{
+		{
+			name:    "earlier block grows the file",
+			content: "a\nb\nc\n",
+			blocks:  []diffBlock{{"a\n", "a\na1\na2\na3\n"}, {"c\n", "C\n"}},
+			want:    "a\na1\na2\na3\nb\nC\n",
+		},
+		{
+			name:    "earlier block shrinks the file",
+			content: "long line one\nlong line two\nx = 1\n",
+			blocks:  []diffBlock{{"long line one\nlong line two\n", ""}, {"x = 1", "x = 2"}},
+			want:    "x = 2\n",
+		},
+		{
+			name:    "blocks out of file order",
+			content: "first\nmiddle\nlast\n",
+			blocks:  []diffBlock{{"last", "LAST!"}, {"first", "1"}, {"middle", "the middle"}},
+			want:    "1\nthe middle\nLAST!\n",
+		},
+		{
+			name:    "later block edits an earlier replacement",
+			content: "x\n",
+			blocks:  []diffBlock{{"x", "y z"}, {"z", "w"}},
+			want:    "y w\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := searchReplaceBlocks(tt.blocks, editOptions{}, false)(context.Background(), tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.content != tt.want {
+				t.Errorf("content = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditFileMultiBlockWritesOnce(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	original := "a\nb\nc\n"
+	if err := os.WriteFile(filename, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every write of the file rotates in a new backup, so a single backup
+	// holding the original shows that the blocks were written together
+	blocks := []diffBlock{{"a\n", "a\n\n"}, {"b", "B"}, {"c", "C"}}
+	if _, err := editFile(filename, searchReplaceBlocks(blocks, editOptions{}, false), runOptions{backupKeep: 3}); err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	assertFileContent(t, filename, "a\n\nB\nC\n")
+	assertFileContent(t, backupName(filename, defaultBackupSuffix, 1), original)
+	if _, err := os.Stat(backupName(filename, defaultBackupSuffix, 2)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("second backup exists (err = %v), want the file written once", err)
+	}
+}
+
+func TestFormatDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want string
+	}{
+		{
+			name: "already canonical",
+			diff: "<<<<<<< SEARCH\nold\n=======\nnew\n>>>>>>> REPLACE\n",
+			want: "<<<<<<< SEARCH\nold\n=======\nnew\n>>>>>>> REPLACE\n",
+		},
+		{
+			name: "surrounding noise and marker suffixes",
+			diff: "\n\n<<<<<<< SEARCH extra\nold\n======= sep\nnew\n>>>>>>> REPLACE\n\n",
+			want: "<<<<<<< SEARCH\nold\n=======\nnew\n>>>>>>> REPLACE\n",
+		},
+		{
+			name: "empty replace block",
+			diff: "<<<<<<< SEARCH\nold\n=======\n>>>>>>> REPLACE",
+			want: "<<<<<<< SEARCH\nold\n=======\n>>>>>>> REPLACE\n",
+		},
+		{
+			name: "missing closing marker",
+			diff: "<<<<<<< SEARCH\nold\n=======\nnew",
+			want: "<<<<<<< SEARCH\nold\n=======\nnew\n>>>>>>> REPLACE\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searchBlock, replaceBlock, err := parseDiff(tt.diff)
+			if err != nil {
+				t.Fatalf("parseDiff() error = %v", err)
+			}
+			got := formatDiff(searchBlock, replaceBlock)
+			if got != tt.want {
+				t.Errorf("formatDiff() = %q, want %q", got, tt.want)
+			}
+
+			// Formatting is idempotent
+			searchBlock, replaceBlock, err = parseDiff(got)
+			if err != nil {
+				t.Fatalf("parseDiff() on formatted diff error = %v", err)
+			}
+			if again := formatDiff(searchBlock, replaceBlock); again != got {
+				t.Errorf("formatDiff() not idempotent: %q, then %q", got, again)
+			}
+		})
+	}
+}
+
 func TestPerformEdit(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -273,6 +691,22 @@ func TestPerformEdit(t *testing.T) {
 			want:         "beginning\nmiddle\nnew end",
 			wantErr:      false,
 		},
+		{
+			name:         "match placeholder",
+			content:      "setup()\nrisky()\ncleanup()",
+			searchBlock:  "risky()",
+			replaceBlock: "try:\n    {{MATCH}}\nexcept Exception:\n    pass",
+			want:         "setup()\ntry:\n    risky()\nexcept Exception:\n    pass\ncleanup()",
+			wantErr:      false,
+		},
+		{
+			name:         "escaped match placeholder",
+			content:      "template = x",
+			searchBlock:  "x",
+			replaceBlock: "\\{{MATCH}} for {{MATCH}}",
+			want:         "template = {{MATCH}} for x",
+			wantErr:      false,
+		},
 		{
 			name:         "whitespace preservation",
 			content:      "  spaced content  \n\ttabbed\n",
@@ -310,6 +744,826 @@ func TestPerformEdit(t *testing.T) {
 	}
 }
 
+func TestApplyEditErrors(t *testing.T) {
+	_, err := applyEdit("some content", "missing", "x", editOptions{})
+	if !errors.Is(err, errSearchNotFound) {
+		t.Errorf("applyEdit() error = %v, want errSearchNotFound", err)
+	}
+
+	_, err = applyEdit("dup dup", "dup", "x", editOptions{})
+	if !errors.Is(err, errAmbiguous) {
+		t.Errorf("applyEdit() error = %v, want errAmbiguous", err)
+	}
+
+	// "aa" occurs at offsets 0 and 1 of "aaa"
+	_, err = applyEdit("aaa", "aa", "x", editOptions{})
+	if !errors.Is(err, errAmbiguous) {
+		t.Errorf("applyEdit() with overlapping matches error = %v, want errAmbiguous", err)
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    editFunc
+		want    string
+		wantErr string
+	}{
+		{name: "append", edit: appendBlock("first\n"), want: "first\n"},
+		{name: "append without newline", edit: appendBlock("first"), want: "first"},
+		{name: "prepend", edit: prependBlock("first\n"), want: "first\n"},
+		{name: "at start", edit: replaceAt(1, 1, 0, "first\n"), want: "first\n"},
+		{name: "search", edit: searchReplace("old", "new", editOptions{}), wantErr: "search block not found: file is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.edit(context.Background(), "")
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("edit() error = %v, want %q", err, tt.wantErr)
+				}
+				if !errors.Is(err, errSearchNotFound) {
+					t.Errorf("edit() error = %v, want errSearchNotFound", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("edit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("edit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditWholeLines(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		searchBlock string
+		wantErr     bool
+	}{
+		{name: "single full line", content: "a\nfoo bar\nb", searchBlock: "foo bar"},
+		{name: "lines with trailing newline", content: "a\nfoo\nbar\nb", searchBlock: "foo\nbar\n"},
+		{name: "at end of file", content: "a\nlast", searchBlock: "last"},
+		{name: "starts mid-line", content: "a\nxfoo\nb", searchBlock: "foo", wantErr: true},
+		{name: "ends mid-line", content: "a\nfoox\nb", searchBlock: "foo", wantErr: true},
+		{name: "suffix of one line into the next", content: "let value\n= 1\n", searchBlock: "value\n= 1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := applyEdit(tt.content, tt.searchBlock, "x", editOptions{wholeLines: true})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "does not span whole lines") {
+					t.Errorf("applyEdit() error = %v, want whole lines error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("applyEdit() error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestApplyEditAt(t *testing.T) {
+	content := "first line\nsecond line\r\nthird"
+
+	tests := []struct {
+		name         string
+		line, col    int
+		length       int
+		replaceBlock string
+		want         string
+		errContains  string
+	}{
+		{name: "replace word", line: 2, col: 1, length: 6, replaceBlock: "2nd", want: "first line\n2nd line\nthird"},
+		{name: "insert at end of line", line: 1, col: 11, length: 0, replaceBlock: "!", want: "first line!\nsecond line\nthird"},
+		{name: "across lines", line: 1, col: 7, length: 11, replaceBlock: "+", want: "first + line\nthird"},
+		{name: "match placeholder", line: 3, col: 1, length: 5, replaceBlock: "[{{MATCH}}]", want: "first line\nsecond line\n[third]"},
+		{name: "line out of range", line: 4, col: 1, errContains: "past the end of the file"},
+		{name: "column out of range", line: 3, col: 7, errContains: "past the end of line 3"},
+		{name: "length out of range", line: 3, col: 2, length: 5, errContains: "outside the file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEditAt(content, tt.line, tt.col, tt.length, tt.replaceBlock)
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("applyEditAt() error = %v, want error containing %v", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEditAt() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEditAt() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyAppend(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		replaceBlock string
+		want         string
+	}{
+		{name: "file ending in newline", content: "a\nb\n", replaceBlock: "c", want: "a\nb\nc\n"},
+		{name: "file without final newline", content: "a\nb", replaceBlock: "c", want: "a\nb\nc"},
+		{name: "block with final newline", content: "a\n", replaceBlock: "c\n", want: "a\nc\n"},
+		{name: "multiline block", content: "a\n", replaceBlock: "b\nc", want: "a\nb\nc\n"},
+		{name: "leading newline after unterminated line", content: "a\nb", replaceBlock: "\nc", want: "a\nb\nc"},
+		{name: "leading newline after terminated line", content: "a\nb\n", replaceBlock: "\nc", want: "a\nb\n\nc\n"},
+		{name: "empty file", content: "", replaceBlock: "c", want: "c"},
+		{name: "empty file with leading newline", content: "", replaceBlock: "\nc", want: "\nc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := applyAppend(tt.content, tt.replaceBlock)
+			if result.content != tt.want {
+				t.Errorf("applyAppend() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPrepend(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		replaceBlock string
+		want         string
+	}{
+		{name: "block without newline", content: "package main\n", replaceBlock: "// Copyright", want: "// Copyright\npackage main\n"},
+		{name: "block with newline", content: "body\n", replaceBlock: "#!/bin/sh\n", want: "#!/bin/sh\nbody\n"},
+		{name: "empty file", content: "", replaceBlock: "header", want: "header"},
+		{name: "after byte order mark", content: "\uFEFFbody", replaceBlock: "header", want: "\uFEFFheader\nbody"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := applyPrepend(tt.content, tt.replaceBlock)
+			if result.content != tt.want {
+				t.Errorf("applyPrepend() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	line, col, err := parsePosition("12:3")
+	if err != nil || line != 12 || col != 3 {
+		t.Errorf("parsePosition(\"12:3\") = %d, %d, %v, want 12, 3, nil", line, col, err)
+	}
+
+	for _, s := range []string{"12", "0:1", "1:0", "a:b", "-1:2"} {
+		if _, _, err := parsePosition(s); err == nil {
+			t.Errorf("parsePosition(%q) error = nil, want error", s)
+		}
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{name: "empty", data: nil, want: false},
+		{name: "text", data: []byte("hello\nworld\n"), want: false},
+		{name: "unicode text", data: []byte("Hello 世界 🌍"), want: false},
+		{name: "nul byte", data: []byte("PK\x03\x04\x00\x00"), want: true},
+		{name: "nul byte past the sniffed prefix", data: append(bytes.Repeat([]byte("a"), 8000), 0), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBinary(tt.data); got != tt.want {
+				t.Errorf("isBinary() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditLineEndingHint(t *testing.T) {
+	const hint = "check your CRLF handling"
+
+	tests := []struct {
+		name        string
+		content     string
+		searchBlock string
+		wantHint    bool
+	}{
+		{name: "old mac line endings in file", content: "one\rtwo\rthree", searchBlock: "one\ntwo", wantHint: true},
+		{name: "stray carriage return in search", content: "one\ntwo\n", searchBlock: "one\r\r\ntwo", wantHint: true},
+		{name: "genuinely missing", content: "one\r\ntwo\r\n", searchBlock: "three", wantHint: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := applyEdit(tt.content, tt.searchBlock, "x", editOptions{})
+			if !errors.Is(err, errSearchNotFound) {
+				t.Fatalf("applyEdit() error = %v, want errSearchNotFound", err)
+			}
+			if got := strings.Contains(err.Error(), hint); got != tt.wantHint {
+				t.Errorf("applyEdit() error = %q, hint present = %v, want %v", err, got, tt.wantHint)
+			}
+		})
+	}
+}
+
+func TestApplyEditIdempotent(t *testing.T) {
+	opts := editOptions{idempotent: true}
+
+	result, err := applyEdit("x = new_name()\n", "x = old_name()", "x = new_name()", opts)
+	if err != nil {
+		t.Fatalf("applyEdit() on edited file error = %v", err)
+	}
+	if result.content != result.original {
+		t.Errorf("applyEdit() changed already edited content to %q", result.content)
+	}
+
+	_, err = applyEdit("from flask import Flask\n", "missing", "also missing", opts)
+	if !errors.Is(err, errSearchNotFound) {
+		t.Errorf("applyEdit() error = %v, want errSearchNotFound", err)
+	}
+
+	_, err = applyEdit("ok\nok\n", "missing", "ok", opts)
+	if !errors.Is(err, errSearchNotFound) {
+		t.Errorf("applyEdit() with ambiguous replace block error = %v, want errSearchNotFound", err)
+	}
+}
+
+func TestEditFileUnchanged(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(filename, []byte("same\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filename, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := editFile(filename, searchReplace("same", "same", editOptions{}), runOptions{})
+	if err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	if !result.unchanged {
+		t.Error("editFile() result.unchanged = false, want true")
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Errorf("file was rewritten: mtime = %v, want %v", info.ModTime(), past)
+	}
+}
+
+func TestEditFileTimeout(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(filename, []byte("original\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	slow := func(_ context.Context, content string) (editResult, error) {
+		<-release
+		return editResult{original: content, content: "edited\n"}, nil
+	}
+
+	_, err := editFile(filename, slow, runOptions{timeout: 10 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("editFile() error = %v, want context.DeadlineExceeded", err)
+	}
+	assertFileContent(t, filename, "original\n")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries after timeout, want only the original file", len(entries))
+	}
+
+	result, err := editFile(filename, searchReplace("original", "edited", editOptions{}), runOptions{timeout: time.Minute})
+	if err != nil {
+		t.Fatalf("editFile() with generous timeout error = %v", err)
+	}
+	if result.content != "edited\n" {
+		t.Errorf("editFile() content = %q, want %q", result.content, "edited\n")
+	}
+	assertFileContent(t, filename, "edited\n")
+}
+
+func TestEditFileMatchTimeout(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(filename, []byte("original\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	slow := func(_ context.Context, content string) (editResult, error) {
+		<-release
+		return editResult{original: content, content: "edited\n"}, nil
+	}
+
+	_, err := editFile(filename, slow, runOptions{timeout: time.Minute, matchTimeout: 10 * time.Millisecond})
+	if !errors.Is(err, errMatchTimeout) {
+		t.Fatalf("editFile() error = %v, want %v", err, errMatchTimeout)
+	}
+	assertFileContent(t, filename, "original\n")
+
+	// The overall --timeout running out first is reported as such
+	_, err = editFile(filename, slow, runOptions{timeout: 10 * time.Millisecond, matchTimeout: time.Minute})
+	if errors.Is(err, errMatchTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("editFile() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	if _, err := editFile(filename, searchReplace("original", "edited", editOptions{}), runOptions{matchTimeout: time.Minute}); err != nil {
+		t.Fatalf("editFile() with generous match timeout error = %v", err)
+	}
+	assertFileContent(t, filename, "edited\n")
+}
+
+func TestEditFileGuards(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        runOptions
+		wantSkipped bool
+	}{
+		{
+			name: "no_guards",
+		},
+		{
+			name: "required_text_present",
+			opts: runOptions{requirePresent: "import old"},
+		},
+		{
+			name:        "required_text_missing",
+			opts:        runOptions{requirePresent: "import new"},
+			wantSkipped: true,
+		},
+		{
+			name: "forbidden_text_absent",
+			opts: runOptions{requireAbsent: "import new"},
+		},
+		{
+			name:        "forbidden_text_present",
+			opts:        runOptions{requireAbsent: "import old"},
+			wantSkipped: true,
+		},
+		{
+			name:        "both_guards_one_fails",
+			opts:        runOptions{requirePresent: "import old", requireAbsent: "call()"},
+			wantSkipped: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "file.go")
+			if err := os.WriteFile(filename, []byte("import old\ncall()\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := editFile(filename, searchReplace("call()", "other()", editOptions{}), tt.opts)
+			if err != nil {
+				t.Fatalf("editFile() error = %v", err)
+			}
+			if (result.skipped != "") != tt.wantSkipped {
+				t.Errorf("editFile() skipped = %q, want skipped %v", result.skipped, tt.wantSkipped)
+			}
+
+			want := "import old\nother()\n"
+			if tt.wantSkipped {
+				want = "import old\ncall()\n"
+			}
+			assertFileContent(t, filename, want)
+		})
+	}
+}
+
+func TestEditFileKeepsCRLF(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(filename, []byte("one\r\ntwo\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := editFile(filename, searchReplace("one\ntwo", "one\nand\ntwo", editOptions{}), runOptions{})
+	if err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	assertFileContent(t, filename, "one\r\nand\r\ntwo\r\n")
+
+	result, err = editFile(filename, searchReplace("and", "and", editOptions{}), runOptions{})
+	if err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	if !result.unchanged {
+		t.Error("editFile() of a CRLF file with a no-op edit: unchanged = false, want true")
+	}
+}
+
+func TestApplyEditNoNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		replace string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "CRLF matched by CRLF",
+			content: "a\r\nb\r\n",
+			search:  "a\r\nb",
+			replace: "x\r\ny",
+			want:    "x\r\ny\r\n",
+		},
+		{
+			name:    "LF does not match CRLF",
+			content: "a\r\nb\r\n",
+			search:  "a\nb",
+			replace: "x",
+			wantErr: errSearchNotFound,
+		},
+		{
+			name:    "CRLF does not match LF",
+			content: "a\nb\n",
+			search:  "a\r\nb",
+			replace: "x",
+			wantErr: errSearchNotFound,
+		},
+		{
+			name:    "mixed line endings are kept",
+			content: "a\r\nb\nc\r\n",
+			search:  "b",
+			replace: "B",
+			want:    "a\r\nB\nc\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.search, tt.replace, editOptions{noNormalize: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyEdit() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditFileNoNormalize(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(filename, []byte("one\r\ntwo\nthree\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := runOptions{edit: editOptions{noNormalize: true}}
+	if _, err := editFile(filename, searchReplace("two\n", "2\n", opts.edit), opts); err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	assertFileContent(t, filename, "one\r\n2\nthree\r\n")
+}
+
+func TestCheckRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		replace string
+		wantErr bool
+	}{
+		{"reversible", "a\nb\nc\n", "b", "B", false},
+		{"replacement already present", "a\nB\nb\n", "b", "B", true},
+		{"deletion", "a\nb\nc\n", "b\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.search, tt.replace, editOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := checkRoundTrip(result, editOptions{}); (err != nil) != tt.wantErr {
+				t.Errorf("checkRoundTrip() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEditFileCountLines(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(filename, []byte("a\nb\nc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := runOptions{countLines: true}
+	result, err := editFile(filename, searchReplace("b", "b1\nb2\nb3", opts.edit), opts)
+	if err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	var out strings.Builder
+	writeLineChanges(&out, "file.txt", result)
+	if got, want := out.String(), "file.txt: 1 lines removed, 3 added (net +2)\n"; got != want {
+		t.Errorf("writeLineChanges() = %q, want %q", got, want)
+	}
+}
+
+func TestEditFileCountLinesCRLF(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(filename, []byte("a\r\nb\r\nc\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := runOptions{countLines: true}
+	result, err := editFile(filename, searchReplace("b", "b1\nb2", opts.edit), opts)
+	if err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	if result.linesRemoved != 1 || result.linesAdded != 2 {
+		t.Errorf("editFile() counted -%d +%d lines, want -1 +2", result.linesRemoved, result.linesAdded)
+	}
+	assertFileContent(t, filename, "a\r\nb1\r\nb2\r\nc\r\n")
+}
+
+func TestWritePhaseTime(t *testing.T) {
+	var b bytes.Buffer
+	writePhaseTime(&b, "app.py", "match", 1500*time.Microsecond+300*time.Nanosecond)
+	if got, want := b.String(), "app.py: match took 1.5ms\n"; got != want {
+		t.Errorf("writePhaseTime() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "edit.diff")
+	if err := os.WriteFile(path, []byte("from file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := loadDiff("from argument", "", 0, 0); err != nil || got != "from argument" {
+		t.Errorf("loadDiff() with --edit = %q, %v, want the argument", got, err)
+	}
+	if got, err := loadDiff("", path, 0, 0); err != nil || got != "from file" {
+		t.Errorf("loadDiff() without --edit = %q, %v, want the file", got, err)
+	}
+}
+
+func TestReadDiffFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		maxSize int64
+		wantErr bool
+	}{
+		{name: "no limit", input: "a\nb\nc", maxSize: 0},
+		{name: "under limit", input: "a\nb\n", maxSize: 8},
+		{name: "at limit", input: "a\nb\n", maxSize: 4},
+		{name: "over limit", input: "a\nb\nc", maxSize: 4, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readDiffFrom(strings.NewReader(tt.input), tt.maxSize)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "--max-diff-size") {
+					t.Fatalf("readDiffFrom() error = %v, want size error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readDiffFrom() error = %v", err)
+			}
+			if got != tt.input {
+				t.Errorf("readDiffFrom() = %q, want %q", got, tt.input)
+			}
+		})
+	}
+}
+
+func TestReadDiffWithin(t *testing.T) {
+	got, err := readDiffWithin(strings.NewReader("diff"), 0, time.Second)
+	if err != nil || got != "diff" {
+		t.Errorf("readDiffWithin() = %q, %v, want the diff", got, err)
+	}
+
+	r, w := io.Pipe()
+	defer w.Close()
+	_, err = readDiffWithin(r, 0, 10*time.Millisecond)
+	if !errors.Is(err, errStdinTimeout) {
+		t.Fatalf("readDiffWithin() on a stalled reader error = %v, want %v", err, errStdinTimeout)
+	}
+	if code := readDiffExitCode(err); code != exitStdinTimeout {
+		t.Errorf("readDiffExitCode() = %d, want %d", code, exitStdinTimeout)
+	}
+}
+
+func TestSizeValue(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    sizeValue
+		wantErr bool
+	}{
+		{input: "0", want: 0},
+		{input: "1500", want: 1500},
+		{input: "512K", want: 512 << 10},
+		{input: "16m", want: 16 << 20},
+		{input: "2G", want: 2 << 30},
+		{input: "-1", wantErr: true},
+		{input: "M", wantErr: true},
+		{input: "99999999999G", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var got sizeValue
+			err := got.Set(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Set(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	if got := sizeValue(defaultMaxDiffSize).String(); got != "64M" {
+		t.Errorf("String() = %q, want %q", got, "64M")
+	}
+}
+
+func TestExpandInPlaceArgs(t *testing.T) {
+	flags := flag.NewFlagSet("apply-edit", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var suffix string
+	flags.Var(inPlaceValue{&suffix}, "i", "")
+	flags.Bool("idempotent", false, "")
+	flags.String("context-before", "", "")
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"bare", []string{"-i", "f.txt"}, []string{"-i", "f.txt"}},
+		{"suffix", []string{"-i.orig", "f.txt"}, []string{"-i=.orig", "f.txt"}},
+		{"other_flag_starting_with_i", []string{"-idempotent", "f.txt"}, []string{"-idempotent", "f.txt"}},
+		{"flag_value", []string{"-context-before", "-ix", "-i~", "f.txt"}, []string{"-context-before", "-ix", "-i=~", "f.txt"}},
+		{"after_filename", []string{"f.txt", "-i.bak"}, []string{"f.txt", "-i.bak"}},
+		{"after_terminator", []string{"--", "-i.bak"}, []string{"--", "-i.bak"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandInPlaceArgs(flags, tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandInPlaceArgs(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+
+	if err := flags.Parse(expandInPlaceArgs(flags, []string{"-i.orig", "f.txt"})); err != nil {
+		t.Fatal(err)
+	}
+	if suffix != ".orig" {
+		t.Errorf("suffix = %q, want %q", suffix, ".orig")
+	}
+	if err := flags.Parse([]string{"-i=sub/dir"}); err == nil {
+		t.Error("suffix with a path separator was accepted")
+	}
+}
+
+func TestEditFileHash(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(filename, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldSum := sha256Hex([]byte("old\n"))
+
+	_, err := editFile(filename, searchReplace("old", "new", editOptions{}), runOptions{expectSHA256: sha256Hex([]byte("other\n"))})
+	if err == nil || !strings.Contains(err.Error(), oldSum) {
+		t.Fatalf("editFile() with wrong expected hash error = %v, want mismatch naming %s", err, oldSum)
+	}
+	assertFileContent(t, filename, "old\n")
+
+	result, err := editFile(filename, searchReplace("old", "new", editOptions{}), runOptions{expectSHA256: strings.ToUpper(oldSum), printHash: true})
+	if err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	if want := sha256Hex([]byte("new\n")); result.sha256 != want {
+		t.Errorf("result.sha256 = %s, want %s", result.sha256, want)
+	}
+
+	var buf bytes.Buffer
+	if err := reportResult(&buf, "file.txt", result, runOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Successfully applied edit to file.txt\n" + result.sha256 + "  file.txt\n"; buf.String() != want {
+		t.Errorf("reportResult() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestEditFileStripTrailingWhitespace(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(filename, []byte("a  \r\nb\t\r\nc\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := editFile(filename, searchReplace("c", "C ", editOptions{}), runOptions{stripOnWrite: true})
+	if err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	assertFileContent(t, filename, "a\r\nb\r\nC\r\n")
+}
+
+func TestEditFileCreate(t *testing.T) {
+	dir := t.TempDir()
+
+	missing := filepath.Join(dir, "missing.txt")
+	if _, err := editFile(missing, appendBlock("first\n"), runOptions{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("editFile() without --create error = %v, want fs.ErrNotExist", err)
+	}
+
+	for _, opts := range []runOptions{{create: true}, {create: true, atomic: true, lock: true, backup: true}} {
+		filename := filepath.Join(dir, fmt.Sprintf("new-%t.txt", opts.atomic))
+		if _, err := editFile(filename, appendBlock("first\n"), opts); err != nil {
+			t.Fatalf("editFile(%+v) error = %v", opts, err)
+		}
+		assertFileContent(t, filename, "first\n")
+		if _, err := os.Stat(filename + defaultBackupSuffix); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("backup of a created file exists, err = %v", err)
+		}
+	}
+
+	dryRun := filepath.Join(dir, "dry-run.txt")
+	if _, err := editFile(dryRun, prependBlock("first\n"), runOptions{create: true, dryRun: true}); err != nil {
+		t.Fatalf("editFile() with --dry-run error = %v", err)
+	}
+	if _, err := os.Stat(dryRun); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("dry run created the file, err = %v", err)
+	}
+}
+
+func TestUnescapeReplace(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`a\nb`, "a\nb"},
+		{`\tindented`, "\tindented"},
+		{`C:\\path`, `C:\path`},
+		{`\\n`, `\n`},
+		{`\x and \`, `\x and \`},
+		{"real\nnewline", "real\nnewline"},
+	}
+
+	for _, tt := range tests {
+		if got := unescapeReplace(tt.input); got != tt.want {
+			t.Errorf("unescapeReplace(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestTrimTrailingWhitespace(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "no trailing", want: "no trailing"},
+		{in: "spaces   \ntabs\t\t\nmixed \t ", want: "spaces\ntabs\nmixed"},
+		{in: "    indented   \n\tkept\t", want: "    indented\n\tkept"},
+		{in: "crlf  \r\nline\t\r\n", want: "crlf\r\nline\r\n"},
+		{in: "   \n", want: "\n"},
+	}
+
+	for _, tt := range tests {
+		if got := trimTrailingWhitespace(tt.in); got != tt.want {
+			t.Errorf("trimTrailingWhitespace(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
 func TestPerformEditEdgeCases(t *testing.T) {
 	t.Run("very large content", func(t *testing.T) {
 		// Test with larger content to ensure performance
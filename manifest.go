@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// manifestEntry is one edit listed in a --manifest file.
+type manifestEntry struct {
+	File string `json:"file"`
+	Diff string `json:"diff"`
+}
+
+// loadManifest reads a JSON array of manifest entries and turns each into an
+// edit job. Entries with an invalid diff become failed jobs rather than
+// aborting the whole manifest.
+func loadManifest(path string, opts runOptions) ([]editJob, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []manifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	jobs := make([]editJob, len(entries))
+	for i, entry := range entries {
+		if entry.File == "" {
+			return nil, fmt.Errorf("entry %d has no file", i+1)
+		}
+		filename, err := resolveUnderRoot(opts.root, entry.File, opts.allowOutside)
+		if err != nil {
+			jobs[i].filename, jobs[i].err = entry.File, err
+			continue
+		}
+		jobs[i].filename = filename
+
+		blocks, err := parseBlocks(entry.Diff, opts.parse)
+		if err != nil {
+			jobs[i].err = fmt.Errorf("parsing diff: %w", err)
+			continue
+		}
+		if opts.lint {
+			writeLintWarnings(os.Stderr, entry.File+": ", blocks, opts.minSearchLength)
+		}
+		jobs[i].edit, jobs[i].err = blocksEdit(blocks, opts)
+	}
+	return jobs, nil
+}
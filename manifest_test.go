@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	for _, filename := range []string{a, b} {
+		if err := os.WriteFile(filename, []byte("old name\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest := filepath.Join(dir, "manifest.json")
+	data := `[
+		{"file": ` + quote(a) + `, "diff": "<<<<<<< SEARCH\nold name\n=======\nnew name\n>>>>>>> REPLACE"},
+		{"file": ` + quote(b) + `, "diff": "not a diff"}
+	]`
+	if err := os.WriteFile(manifest, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := loadManifest(manifest, runOptions{})
+	if err != nil {
+		t.Fatalf("loadManifest() error = %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("got %d jobs, want 2", len(jobs))
+	}
+	if jobs[0].filename != a || jobs[0].err != nil {
+		t.Errorf("jobs[0] = %+v, want a ready job for %s", jobs[0], a)
+	}
+	if jobs[1].filename != b || jobs[1].err == nil {
+		t.Errorf("jobs[1] = %+v, want a failed job for %s", jobs[1], b)
+	}
+
+	if _, err := editFile(a, jobs[0].edit, runOptions{}); err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	assertFileContent(t, a, "new name\n")
+}
+
+func TestLoadManifestRoot(t *testing.T) {
+	root := t.TempDir()
+	a := filepath.Join(root, "src", "a.txt")
+	if err := os.MkdirAll(filepath.Dir(a), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(a, []byte("old name\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := filepath.Join(t.TempDir(), "manifest.json")
+	data := `[
+		{"file": "src/a.txt", "diff": "<<<<<<< SEARCH\nold name\n=======\nnew name\n>>>>>>> REPLACE"},
+		{"file": "../b.txt", "diff": "<<<<<<< SEARCH\nold name\n=======\nnew name\n>>>>>>> REPLACE"}
+	]`
+	if err := os.WriteFile(manifest, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := loadManifest(manifest, runOptions{root: root})
+	if err != nil {
+		t.Fatalf("loadManifest() error = %v", err)
+	}
+	if jobs[0].filename != a || jobs[0].err != nil {
+		t.Errorf("jobs[0] = %+v, want a ready job for %s", jobs[0], a)
+	}
+	if jobs[1].filename != "../b.txt" || jobs[1].err == nil {
+		t.Errorf("jobs[1] = %+v, want a failed job for ../b.txt", jobs[1])
+	}
+
+	jobs, err = loadManifest(manifest, runOptions{root: root, allowOutside: true})
+	if err != nil {
+		t.Fatalf("loadManifest() error = %v", err)
+	}
+	if want := filepath.Join(filepath.Dir(root), "b.txt"); jobs[1].filename != want || jobs[1].err != nil {
+		t.Errorf("jobs[1] = %+v, want a ready job for %s", jobs[1], want)
+	}
+}
+
+func TestLoadManifestInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"not-json.json":     `{`,
+		"missing-file.json": `[{"diff": "<<<<<<< SEARCH\nx\n=======\ny\n>>>>>>> REPLACE"}]`,
+	} {
+		manifest := filepath.Join(dir, name)
+		if err := os.WriteFile(manifest, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadManifest(manifest, runOptions{}); err == nil {
+			t.Errorf("loadManifest(%s) error = nil, want error", name)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import "strings"
+
+// minFence is the length of the marker runs in a standard diff block. A block
+// can be fenced with longer runs, such as <<<<<<<< SEARCH, so that it may
+// contain lines that look like standard markers: inside it, only markers of
+// the same length count.
+const minFence = 7
+
+// markerRun returns the length of the run of c that starts line.
+func markerRun(line string, c byte) int {
+	n := 0
+	for n < len(line) && line[n] == c {
+		n++
+	}
+	return n
+}
+
+// searchMarker returns the fence length of line if it is a SEARCH marker, or
+// 0 if it isn't one.
+func searchMarker(line string) int {
+	n := markerRun(line, '<')
+	if n >= minFence && strings.HasPrefix(line[n:], " SEARCH") {
+		return n
+	}
+	return 0
+}
+
+// isDivider reports whether line is the divider of a block fenced with fence
+// characters. Outside any block, fence is 0 and a run of any length counts.
+func isDivider(line string, fence int) bool {
+	return fenceMatches(markerRun(line, '='), fence)
+}
+
+// isReplaceMarker reports whether line is the REPLACE marker of a block
+// fenced with fence characters, or of any block if fence is 0.
+func isReplaceMarker(line string, fence int) bool {
+	n := markerRun(line, '>')
+	return fenceMatches(n, fence) && strings.HasPrefix(line[n:], " REPLACE")
+}
+
+func fenceMatches(n, fence int) bool {
+	if fence == 0 {
+		return n >= minFence
+	}
+	return n == fence
+}
+
+// opensBlock reports whether line starts a new block, and with what fence,
+// when the current block is fenced with fence characters. A SEARCH marker of
+// another length is content of the current block.
+func opensBlock(line string, fence int) (int, bool) {
+	n := searchMarker(line)
+	return n, n > 0 && (fence == 0 || n == fence)
+}
+
+// blockFence returns the shortest fence that none of the lines of the given
+// blocks can be mistaken for.
+func blockFence(blocks ...string) int {
+	for fence := minFence; ; fence++ {
+		if !fenceCollides(fence, blocks) {
+			return fence
+		}
+	}
+}
+
+func fenceCollides(fence int, blocks []string) bool {
+	for _, block := range blocks {
+		for _, line := range strings.Split(block, "\n") {
+			if searchMarker(line) == fence || isDivider(line, fence) || isReplaceMarker(line, fence) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unescapeMarker strips one escape prefix from a line that is a marker line
+// after one or more escapes, so that \<<<<<<< SEARCH becomes <<<<<<< SEARCH
+// and \\<<<<<<< SEARCH becomes \<<<<<<< SEARCH. Other lines, and every line
+// when escape is empty, are returned unchanged.
+func unescapeMarker(line, escape string) string {
+	if escape == "" || !strings.HasPrefix(line, escape) {
+		return line
+	}
+	rest := line
+	for strings.HasPrefix(rest, escape) {
+		rest = rest[len(escape):]
+	}
+	if searchMarker(rest) == 0 && !isDivider(rest, 0) && !isReplaceMarker(rest, 0) {
+		return line
+	}
+	return line[len(escape):]
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBlocksFenced(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want []diffBlock
+	}{
+		{
+			name: "standard markers inside a longer fence",
+			diff: "<<<<<<<< SEARCH\n<<<<<<< SEARCH\nold\n=======\n========\n<<<<<<< SEARCH\nnew\n=======\n>>>>>>>> REPLACE\n",
+			want: []diffBlock{{"<<<<<<< SEARCH\nold\n=======", "<<<<<<< SEARCH\nnew\n======="}},
+		},
+		{
+			name: "blocks with different fences",
+			diff: "<<<<<<< SEARCH\na\n=======\nb\n>>>>>>> REPLACE\n<<<<<<<< SEARCH\n>>>>>>> REPLACE\n========\nc\n>>>>>>>> REPLACE\n",
+			want: []diffBlock{{"a", "b"}, {">>>>>>> REPLACE", "c"}},
+		},
+		{
+			name: "longer run in a standard block is content",
+			diff: "<<<<<<< SEARCH\n========\n=======\nx\n>>>>>>> REPLACE\n",
+			want: []diffBlock{{"========", "x"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBlocks(tt.diff, parseOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBlocks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatDiffFence(t *testing.T) {
+	tests := []struct {
+		name            string
+		search, replace string
+		wantFence       int
+	}{
+		{"plain", "a", "b", 7},
+		{"divider in search", "=======", "b", 8},
+		{"markers of two lengths", "<<<<<<< SEARCH\n>>>>>>>> REPLACE", "b", 9},
+		{"unrelated longer run", "==========", "b", 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := formatDiff(tt.search, tt.replace)
+			if got := searchMarker(diff); got != tt.wantFence {
+				t.Errorf("formatDiff() fence = %d, want %d in %q", got, tt.wantFence, diff)
+			}
+			search, replace, err := parseDiff(diff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if search != tt.search || replace != tt.replace {
+				t.Errorf("parseDiff(formatDiff()) = %q, %q, want %q, %q", search, replace, tt.search, tt.replace)
+			}
+		})
+	}
+}
+
+func TestParseBlocksMarkerEscape(t *testing.T) {
+	tests := []struct {
+		name   string
+		escape string
+		diff   string
+		want   []diffBlock
+	}{
+		{
+			name:   "escaped markers in the search block",
+			escape: `\`,
+			diff:   "<<<<<<< SEARCH\n\\<<<<<<< SEARCH\nold\n\\=======\n=======\nnew\n>>>>>>> REPLACE\n",
+			want:   []diffBlock{{"<<<<<<< SEARCH\nold\n=======", "new"}},
+		},
+		{
+			name:   "escaped markers in the replace block",
+			escape: `\`,
+			diff:   "<<<<<<< SEARCH\nold\n=======\n\\<<<<<<< SEARCH\n\\>>>>>>> REPLACE\n>>>>>>> REPLACE\n",
+			want:   []diffBlock{{"old", "<<<<<<< SEARCH\n>>>>>>> REPLACE"}},
+		},
+		{
+			name:   "escaped escape keeps one escape",
+			escape: `\`,
+			diff:   "<<<<<<< SEARCH\n\\\\<<<<<<< SEARCH\n=======\nx\n>>>>>>> REPLACE\n",
+			want:   []diffBlock{{"\\<<<<<<< SEARCH", "x"}},
+		},
+		{
+			name:   "other lines keep the escape",
+			escape: `\`,
+			diff:   "<<<<<<< SEARCH\n\\n\n=======\n\\<<< SEARCH\n>>>>>>> REPLACE\n",
+			want:   []diffBlock{{"\\n", "\\<<< SEARCH"}},
+		},
+		{
+			name:   "longer escape",
+			escape: "%%",
+			diff:   "<<<<<<< SEARCH\n%%>>>>>>> REPLACE\n=======\nx\n>>>>>>> REPLACE\n",
+			want:   []diffBlock{{">>>>>>> REPLACE", "x"}},
+		},
+		{
+			name: "no escape configured",
+			diff: "<<<<<<< SEARCH\n\\<<<<<<< SEARCH\n=======\nx\n>>>>>>> REPLACE\n",
+			want: []diffBlock{{"\\<<<<<<< SEARCH", "x"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBlocks(tt.diff, parseOptions{markerEscape: tt.escape})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBlocks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
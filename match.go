@@ -0,0 +1,591 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// span is the byte range [start, end) of an occurrence in the content.
+type span struct {
+	start, end int
+}
+
+// findMatch locates search in content. It returns the byte range of the first
+// occurrence and how many occurrences were found.
+func findMatch(content, search string, opts editOptions) (start, end, count int) {
+	if search == "" {
+		// The empty search block matches at every offset, so it is never unique
+		return 0, 0, 2
+	}
+
+	matches := findMatches(content, search, opts)
+	if len(matches) == 0 {
+		if opts.fuzz > 0 {
+			return fuzzyFind(content, search, opts.fuzz, opts)
+		}
+		return 0, 0, 0
+	}
+	return matches[0].start, matches[0].end, len(matches)
+}
+
+// findMatches returns every occurrence of search in content that is
+// surrounded by the required context. With wildcard lines, these are the
+// regions matched by the anchors around them. Overlapping occurrences are all
+// counted, so that a search block matching in two overlapping places is
+// ambiguous rather than silently resolved to the first.
+func findMatches(content, search string, opts editOptions) []span {
+	if anchors := splitWildcard(search, opts.wildcardLine); len(anchors) > 1 {
+		return wildcardMatches(content, anchors, opts)
+	}
+	contentView := matchView(content, opts)
+	viewSearch := matchView(search, opts).text
+
+	var matches []span
+	for _, m := range contentView.findAll(opts.ctx, viewSearch) {
+		switch {
+		case !hasContext(content, m, opts):
+		case opts.wholeWord && !isWholeWord(content, m):
+		case opts.lineAnchored && !isWholeLines(content, m.start, m.end):
+		default:
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// isWholeWord reports whether m is not part of a longer word: a match that
+// starts or ends with a word character must not continue a word on that
+// side.
+func isWholeWord(content string, m span) bool {
+	if m.start > 0 && m.start < m.end {
+		before, _ := utf8.DecodeLastRuneInString(content[:m.start])
+		first, _ := utf8.DecodeRuneInString(content[m.start:m.end])
+		if isWordRune(before) && isWordRune(first) {
+			return false
+		}
+	}
+	if m.end < len(content) && m.start < m.end {
+		last, _ := utf8.DecodeLastRuneInString(content[m.start:m.end])
+		after, _ := utf8.DecodeRuneInString(content[m.end:])
+		if isWordRune(last) && isWordRune(after) {
+			return false
+		}
+	}
+	return true
+}
+
+// isWordRune reports whether r can be part of an identifier.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// hasContext reports whether the lines right before and after m match the
+// context required by opts.
+func hasContext(content string, m span, opts editOptions) bool {
+	if opts.contextBefore != "" {
+		before := content[:m.start]
+		if m.start == 0 || content[m.start-1] == '\n' {
+			before = strings.TrimSuffix(before, "\n")
+		}
+		if !strings.HasSuffix(before, strings.TrimSuffix(opts.contextBefore, "\n")) {
+			return false
+		}
+	}
+	if opts.contextAfter != "" {
+		after := content[m.end:]
+		if m.end == m.start || content[m.end-1] != '\n' {
+			after = strings.TrimPrefix(after, "\n")
+		}
+		if !strings.HasPrefix(after, opts.contextAfter) {
+			return false
+		}
+	}
+	return true
+}
+
+// anchorIndent finds the indentation at which the first line of search must
+// start for search to match content, when it doesn't match as given. The
+// rest of the search block must match exactly. It returns how many distinct
+// indentations work, so a count other than 1 means no usable anchor.
+func anchorIndent(content, search string, opts editOptions) (indent string, count int) {
+	if len(findMatches(content, search, opts)) > 0 {
+		return "", 0
+	}
+	first, _, _ := strings.Cut(search, "\n")
+	body := strings.TrimLeft(first, " \t")
+	if body == "" {
+		return "", 0
+	}
+
+	tried := map[string]bool{first[:len(first)-len(body)]: true}
+	for _, line := range strings.Split(content, "\n") {
+		lineBody := strings.TrimLeft(line, " \t")
+		candidate := line[:len(line)-len(lineBody)]
+		if !strings.HasPrefix(lineBody, body) || tried[candidate] {
+			continue
+		}
+		tried[candidate] = true
+
+		for _, m := range findMatches(content, reindentFirstLine(search, search, candidate), opts) {
+			// The new indentation has to be that of a whole line
+			if m.start == 0 || content[m.start-1] == '\n' {
+				indent = candidate
+				count++
+				break
+			}
+		}
+	}
+	return indent, count
+}
+
+// reindentFirstLine gives the first line of block the indentation indent in
+// place of the indentation of the first line of search, which block shares.
+func reindentFirstLine(block, search, indent string) string {
+	first, _, _ := strings.Cut(search, "\n")
+	old := first[:len(first)-len(strings.TrimLeft(first, " \t"))]
+	if !strings.HasPrefix(block, old) {
+		return block
+	}
+	return indent + block[len(old):]
+}
+
+// view is a transformed copy of some original text along with a mapping from
+// each byte of the copy back to its offset in the original. Matching is done
+// against the copy and the result mapped back so that edits are spliced at
+// the true offsets.
+type view struct {
+	text string
+	// offsets[i] is the original offset of text[i]. It holds one extra
+	// entry for the end of the text. A nil slice is the identity mapping.
+	offsets []int
+}
+
+func identityView(s string) view {
+	return view{text: s}
+}
+
+// matchView is the view that search blocks are matched against, with every
+// normalization requested in opts applied.
+func matchView(s string, opts editOptions) view {
+	v := identityView(s)
+	if opts.comments != nil {
+		v = stripComments(v.text, *opts.comments)
+	}
+	if opts.tolerateBlankLines {
+		v = composeViews(v, dropBlankLines(v.text))
+	}
+	v = composeViews(v, normalizedView(v.text, opts))
+	if opts.preserveCase {
+		v = composeViews(v, foldCaseView(v.text))
+	}
+	return v
+}
+
+// dropBlankLines returns a view of s without its blank lines, so that blocks
+// match whether or not blank lines were added or removed between their
+// lines.
+func dropBlankLines(s string) view {
+	var builder strings.Builder
+	offsets := make([]int, 0, len(s)+1)
+	for lineStart := 0; lineStart < len(s); {
+		lineEnd := strings.IndexByte(s[lineStart:], '\n') + 1
+		if lineEnd == 0 {
+			lineEnd = len(s)
+		} else {
+			lineEnd += lineStart
+		}
+		if line := s[lineStart:lineEnd]; strings.TrimSpace(line) != "" {
+			builder.WriteString(line)
+			for i := range len(line) {
+				offsets = append(offsets, lineStart+i)
+			}
+		}
+		lineStart = lineEnd
+	}
+	offsets = append(offsets, len(s))
+	return view{text: builder.String(), offsets: offsets}
+}
+
+// normalizedView applies the per-line normalizations requested in opts:
+// dropping whitespace at the end of lines and expanding tabs in indentation
+// to spaces.
+func normalizedView(s string, opts editOptions) view {
+	if !opts.ignoreEOLWhitespace && !opts.equivalentIndent {
+		return identityView(s)
+	}
+
+	var builder strings.Builder
+	offsets := make([]int, 0, len(s)+1)
+	emit := func(text string, offset int) {
+		builder.WriteString(text)
+		for i := range len(text) {
+			offsets = append(offsets, offset+i)
+		}
+	}
+
+	lineStart := 0
+	for lineStart <= len(s) {
+		lineEnd := strings.IndexByte(s[lineStart:], '\n')
+		if lineEnd == -1 {
+			lineEnd = len(s)
+		} else {
+			lineEnd += lineStart
+		}
+
+		line := s[lineStart:lineEnd]
+		if opts.ignoreEOLWhitespace {
+			line = strings.TrimRight(line, " \t")
+		}
+		body := 0
+		if opts.equivalentIndent {
+			column := 0
+			for ; body < len(line) && (line[body] == ' ' || line[body] == '\t'); body++ {
+				width := 1
+				if line[body] == '\t' {
+					width = opts.tabStop() - column%opts.tabStop()
+				}
+				// Every expanded space maps back to the original character
+				for range width {
+					builder.WriteByte(' ')
+					offsets = append(offsets, lineStart+body)
+				}
+				column += width
+			}
+		}
+		emit(line[body:], lineStart+body)
+
+		if lineEnd < len(s) {
+			emit("\n", lineEnd)
+		}
+		lineStart = lineEnd + 1
+	}
+	offsets = append(offsets, len(s))
+
+	return view{text: builder.String(), offsets: offsets}
+}
+
+// findAll returns the occurrences of search in the view, including ones that
+// overlap, mapped back to the original text. It gives up once ctx, if not
+// nil, is done.
+func (v view) findAll(ctx context.Context, search string) []span {
+	var matches []span
+	for offset := 0; offset <= len(v.text); {
+		if ctx != nil && ctx.Err() != nil {
+			return nil
+		}
+		index := strings.Index(v.text[offset:], search)
+		if index == -1 {
+			break
+		}
+		index += offset
+		offset = index + 1
+		if v.splits(index) || v.splits(index+len(search)) {
+			continue
+		}
+
+		start, end := v.span(index, index+len(search))
+		matches = append(matches, span{start, end})
+	}
+	return matches
+}
+
+// splits reports whether offset i of the view falls inside the expansion of
+// a single original character, such as a tab expanded to spaces. Matches
+// must not start or end there since the edit would split that character.
+func (v view) splits(i int) bool {
+	return v.offsets != nil && i > 0 && i < len(v.text) && v.offsets[i] == v.offsets[i-1]
+}
+
+// span maps the range [i, j) of the view back to the original text. When the
+// range stops at the end of a line, it is extended over any original bytes
+// the view dropped there so that nothing is left dangling after the edit.
+func (v view) span(i, j int) (int, int) {
+	if v.offsets == nil {
+		return i, j
+	}
+
+	start := v.offsets[i]
+	if j == i {
+		return start, start
+	}
+	end := v.offsets[j-1] + 1
+	if v.text[j-1] != '\n' && (j == len(v.text) || v.text[j] == '\n') {
+		end = v.offsets[j]
+	}
+	return start, end
+}
+
+// maxFuzz is the largest --fuzz accepted. Far below it, a fuzzy match is
+// unlikely to be the intended region anyway.
+const maxFuzz = 1000
+
+// fuzzyCandidate is a run of whole lines in the content that is within the
+// allowed edit distance of the search block.
+type fuzzyCandidate struct {
+	line     int // index of the first line
+	lines    int // number of lines covered
+	distance int // line-level edit distance to the search block
+	matched  int // lines equal to a search line, in order
+}
+
+// better reports whether c is a closer match than other for a search block of
+// m lines: a smaller distance, then more matching lines, then a length closer
+// to the search block.
+func (c fuzzyCandidate) better(other fuzzyCandidate, m int) bool {
+	if c.distance != other.distance {
+		return c.distance < other.distance
+	}
+	if c.matched != other.matched {
+		return c.matched > other.matched
+	}
+	return abs(c.lines-m) < abs(other.lines-m)
+}
+
+// fuzzyFind looks for the run of whole lines in content that is closest to
+// search by line-level edit distance, accepting at most maxDistance differing
+// lines. Ties between candidates that overlap are resolved in favour of the
+// one with more matching lines; ties in distance between separate regions
+// make the match ambiguous.
+func fuzzyFind(content, search string, maxDistance int, opts editOptions) (start, end, count int) {
+	contentLines := splitLines(content)
+	searchLines := splitLines(search)
+	if len(searchLines) == 0 {
+		return 0, 0, 0
+	}
+
+	candidates := withFuzzyContext(content, search, fuzzyCandidates(contentLines, searchLines, maxDistance, opts), opts)
+	if len(candidates) == 0 {
+		return 0, 0, 0
+	}
+
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if c.better(best, len(searchLines)) {
+			best = c
+		}
+	}
+
+	count = 1
+	for _, c := range candidates {
+		if c.distance == best.distance && (c.line >= best.line+best.lines || best.line >= c.line+c.lines) {
+			count = 2
+			break
+		}
+	}
+
+	m := fuzzySpan(content, lineOffsets(content), search, best)
+	return m.start, m.end, count
+}
+
+// withFuzzyContext drops the candidates that lack the context required by
+// opts, like findMatches does for exact occurrences.
+func withFuzzyContext(content, search string, candidates []fuzzyCandidate, opts editOptions) []fuzzyCandidate {
+	if opts.contextBefore == "" && opts.contextAfter == "" {
+		return candidates
+	}
+	offsets := lineOffsets(content)
+	return slices.DeleteFunc(candidates, func(c fuzzyCandidate) bool {
+		return !hasContext(content, fuzzySpan(content, offsets, search, c), opts)
+	})
+}
+
+// lineOffsets returns the byte offset at which each line of content starts,
+// followed by one past the end of the content, as if it ended with a newline.
+func lineOffsets(content string) []int {
+	offsets := []int{0}
+	for i := range len(content) {
+		if content[i] == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+	if !strings.HasSuffix(content, "\n") {
+		offsets = append(offsets, len(content)+1)
+	}
+	return offsets
+}
+
+// fuzzySpan converts the line range of c back to byte offsets. The match
+// covers the newline after its last line only if search ends with one.
+func fuzzySpan(content string, offsets []int, search string, c fuzzyCandidate) span {
+	start, end := offsets[c.line], offsets[c.line+c.lines]
+	if !strings.HasSuffix(search, "\n") || end > len(content) {
+		end--
+	}
+	return span{start, end}
+}
+
+// fuzzyCandidates returns, for every starting line, the closest run of lines
+// within maxDistance of the search lines. At least one line must match.
+func fuzzyCandidates(contentLines, searchLines []string, maxDistance int, opts editOptions) []fuzzyCandidate {
+	equal := lineComparer(opts)
+
+	// A candidate differs in fewer lines than the search block has, so
+	// larger distances only make the rows below bigger
+	m := len(searchLines)
+	maxDistance = min(maxDistance, m, len(contentLines))
+	var candidates []fuzzyCandidate
+	prev := make([]int, m+maxDistance+1)
+	cur := make([]int, m+maxDistance+1)
+	for i := range contentLines {
+		if opts.ctx != nil && opts.ctx.Err() != nil {
+			return nil
+		}
+		window := contentLines[i:min(len(contentLines), i+m+maxDistance)]
+
+		// Edit distance between the search lines and every prefix of the
+		// window, computed one search line at a time. After the loop,
+		// prev[k] is the distance to window[:k].
+		for k := range len(window) + 1 {
+			prev[k] = k
+		}
+		for j := 1; j <= m; j++ {
+			cur[0] = j
+			for k := 1; k <= len(window); k++ {
+				cost := 1
+				if equal(searchLines[j-1], window[k-1]) {
+					cost = 0
+				}
+				cur[k] = min(prev[k]+1, cur[k-1]+1, prev[k-1]+cost)
+			}
+			prev, cur = cur, prev
+		}
+
+		best := fuzzyCandidate{line: i, distance: -1}
+		for k := 1; k <= len(window); k++ {
+			d := prev[k]
+			if d > maxDistance || d >= max(m, k) {
+				continue
+			}
+			c := fuzzyCandidate{
+				line:     i,
+				lines:    k,
+				distance: d,
+				matched:  commonLines(searchLines, window[:k], equal),
+			}
+			if best.distance == -1 || c.better(best, m) {
+				best = c
+			}
+		}
+		if best.distance != -1 {
+			candidates = append(candidates, best)
+		}
+	}
+	return candidates
+}
+
+// lineComparer returns the line equality used by line-based matching, which
+// honours the same normalizations as matchView.
+func lineComparer(opts editOptions) func(a, b string) bool {
+	if !opts.ignoreEOLWhitespace && !opts.equivalentIndent && opts.comments == nil && !opts.tolerateBlankLines {
+		return func(a, b string) bool { return a == b }
+	}
+	return func(a, b string) bool {
+		return matchView(a, opts).text == matchView(b, opts).text
+	}
+}
+
+// commonLines is the length of the longest common subsequence of a and b.
+func commonLines(a, b []string, equal func(a, b string) bool) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if equal(a[i], b[j]) {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// matchReport lists the regions of content that search matches, for an
+// ambiguous match. Exact matches are shown with their occurrenceHash. Without
+// exact matches, these are the distinct regions found by fuzzy matching along
+// with how similar each is to the search block.
+func matchReport(content, search string, opts editOptions) string {
+	var b strings.Builder
+	b.WriteString("candidates:")
+	hint := "add --context-before or --context-after to single one out"
+	if matches := findMatches(content, search, opts); len(matches) > 0 {
+		hint = "add --context-before or --context-after, or pass a hash to --occurrence-hash, to single one out"
+		for _, m := range matches {
+			first := strings.Count(content[:m.start], "\n") + 1
+			last := first + strings.Count(strings.TrimSuffix(content[m.start:m.end], "\n"), "\n")
+			fmt.Fprintf(&b, "\n  lines %d-%d: exact match, hash %s", first, last, occurrenceHash(content, m)[:shownHashLength])
+		}
+	} else {
+		searchLines := splitLines(search)
+		for _, c := range fuzzyRegions(content, search, opts) {
+			similarity := 100 - 100*c.distance/max(len(searchLines), c.lines)
+			fmt.Fprintf(&b, "\n  lines %d-%d: %d%% similar, %d of %d lines match", c.line+1, c.line+c.lines, similarity, c.matched, len(searchLines))
+		}
+	}
+	b.WriteString("\nhint: " + hint)
+	return b.String()
+}
+
+// maxListedOccurrences is how many occurrences an ambiguity error lists.
+const maxListedOccurrences = 10
+
+// occurrenceList shows where the exact matches of an ambiguous search block
+// are, giving the line each one starts on and a preview of it.
+func occurrenceList(content string, matches []span) string {
+	var b strings.Builder
+	b.WriteString("occurrences:")
+	for _, m := range matches[:min(len(matches), maxListedOccurrences)] {
+		lineStart := strings.LastIndex(content[:m.start], "\n") + 1
+		lineEnd := strings.IndexByte(content[m.start:], '\n')
+		if lineEnd == -1 {
+			lineEnd = len(content)
+		} else {
+			lineEnd += m.start
+		}
+		fmt.Fprintf(&b, "\n  line %d: %s", strings.Count(content[:m.start], "\n")+1, blockSummary(content[lineStart:lineEnd]))
+	}
+	if hidden := len(matches) - maxListedOccurrences; hidden > 0 {
+		fmt.Fprintf(&b, "\n  and %d more (--match-report lists them all)", hidden)
+	}
+	return b.String()
+}
+
+// fuzzyRegions returns the fuzzy candidates that don't overlap a closer one,
+// in file order.
+func fuzzyRegions(content, search string, opts editOptions) []fuzzyCandidate {
+	searchLines := splitLines(search)
+	candidates := withFuzzyContext(content, search, fuzzyCandidates(splitLines(content), searchLines, opts.fuzz, opts), opts)
+	slices.SortStableFunc(candidates, func(a, b fuzzyCandidate) int {
+		switch {
+		case a.better(b, len(searchLines)):
+			return -1
+		case b.better(a, len(searchLines)):
+			return 1
+		}
+		return 0
+	})
+
+	var regions []fuzzyCandidate
+	for _, c := range candidates {
+		overlaps := slices.ContainsFunc(regions, func(r fuzzyCandidate) bool {
+			return c.line < r.line+r.lines && r.line < c.line+c.lines
+		})
+		if !overlaps {
+			regions = append(regions, c)
+		}
+	}
+	slices.SortFunc(regions, func(a, b fuzzyCandidate) int { return a.line - b.line })
+	return regions
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
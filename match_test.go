@@ -0,0 +1,824 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyEditIgnoreEOLWhitespace(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		searchBlock  string
+		replaceBlock string
+		want         string
+		wantErr      bool
+		errContains  string
+	}{
+		{
+			name:         "trailing whitespace in file",
+			content:      "foo  \nbar\t\nbaz",
+			searchBlock:  "foo\nbar",
+			replaceBlock: "X",
+			want:         "X\nbaz",
+		},
+		{
+			name:         "trailing whitespace in search",
+			content:      "foo\nbar\nbaz",
+			searchBlock:  "foo   \nbar \n",
+			replaceBlock: "X\n",
+			want:         "X\nbaz",
+		},
+		{
+			name:         "whitespace-only line after match is kept",
+			content:      "foo \n  \nbar",
+			searchBlock:  "foo\n",
+			replaceBlock: "X\n",
+			want:         "X\n  \nbar",
+		},
+		{
+			name:         "indentation still matters",
+			content:      "foo \n  bar",
+			searchBlock:  "foo\nbar",
+			replaceBlock: "X",
+			wantErr:      true,
+			errContains:  "search block not found",
+		},
+		{
+			name:         "internal whitespace still matters",
+			content:      "a  b \n",
+			searchBlock:  "a b",
+			replaceBlock: "X",
+			wantErr:      true,
+			errContains:  "search block not found",
+		},
+		{
+			name:         "ambiguity is detected on trimmed text",
+			content:      "dup \nx\ndup\n",
+			searchBlock:  "dup\n",
+			replaceBlock: "X\n",
+			wantErr:      true,
+			errContains:  "multiple occurrences",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.searchBlock, tt.replaceBlock, editOptions{ignoreEOLWhitespace: true})
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("applyEdit() error = nil, wantErr = true")
+					return
+				}
+				if tt.errContains != "" && !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("applyEdit() error = %v, want error containing %v", err, tt.errContains)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("applyEdit() error = %v, wantErr = false", err)
+				return
+			}
+
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizedViewTrimEOL(t *testing.T) {
+	s := "ab  \n\t\ncd "
+	v := normalizedView(s, editOptions{ignoreEOLWhitespace: true})
+
+	if want := "ab\n\ncd"; v.text != want {
+		t.Fatalf("text = %q, want %q", v.text, want)
+	}
+	if len(v.offsets) != len(v.text)+1 {
+		t.Fatalf("len(offsets) = %d, want %d", len(v.offsets), len(v.text)+1)
+	}
+	for i := range len(v.text) {
+		if s[v.offsets[i]] != v.text[i] {
+			t.Errorf("offsets[%d] = %d maps to %q, want %q", i, v.offsets[i], s[v.offsets[i]], v.text[i])
+		}
+	}
+}
+
+func TestApplyEditFuzz(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		searchBlock  string
+		replaceBlock string
+		fuzz         int
+		want         string
+		wantErr      bool
+		errContains  string
+	}{
+		{
+			name:         "one differing line",
+			content:      "func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2\n}\n",
+			searchBlock:  "func b() {\n\treturn 3\n}\n",
+			replaceBlock: "func b() {\n\treturn 4\n}\n",
+			fuzz:         1,
+			want:         "func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 4\n}\n",
+		},
+		{
+			name:         "missing line in search",
+			content:      "one\ntwo\nthree\nfour",
+			searchBlock:  "one\nthree\nfour",
+			replaceBlock: "1\n2\n3\n4",
+			fuzz:         1,
+			want:         "1\n2\n3\n4",
+		},
+		{
+			name:         "too many differences",
+			content:      "one\ntwo\nthree\nfour",
+			searchBlock:  "one\nTWO\nTHREE\nfour",
+			replaceBlock: "x",
+			fuzz:         1,
+			wantErr:      true,
+			errContains:  "search block not found",
+		},
+		{
+			name:         "exact match is preferred",
+			content:      "alpha\nbeta\nalpha\ngamma\n",
+			searchBlock:  "alpha\ngamma\n",
+			replaceBlock: "delta\n",
+			fuzz:         1,
+			want:         "alpha\nbeta\ndelta\n",
+		},
+		{
+			name:         "equally close separate regions are ambiguous",
+			content:      "start\nx = 1\nend\nstart\nx = 2\nend\n",
+			searchBlock:  "start\nx = 3\nend\n",
+			replaceBlock: "replaced\n",
+			fuzz:         1,
+			wantErr:      true,
+			errContains:  "multiple occurrences",
+		},
+		{
+			name:         "huge fuzz is clamped",
+			content:      "one\ntwo\nthree",
+			searchBlock:  "one\n2\nthree",
+			replaceBlock: "x",
+			fuzz:         2000000000,
+			want:         "x",
+		},
+		{
+			name:         "fuzz disabled",
+			content:      "one\ntwo\nthree",
+			searchBlock:  "one\n2\nthree",
+			replaceBlock: "x",
+			fuzz:         0,
+			wantErr:      true,
+			errContains:  "search block not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.searchBlock, tt.replaceBlock, editOptions{fuzz: tt.fuzz})
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("applyEdit() error = nil, wantErr = true")
+					return
+				}
+				if tt.errContains != "" && !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("applyEdit() error = %v, want error containing %v", err, tt.errContains)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("applyEdit() error = %v, wantErr = false", err)
+				return
+			}
+
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditContext(t *testing.T) {
+	content := "func a() {\n\treturn nil\n}\n\nfunc b() {\n\treturn nil\n}\n"
+
+	tests := []struct {
+		name        string
+		searchBlock string
+		before      string
+		after       string
+		want        string
+		errContains string
+	}{
+		{
+			name:        "ambiguous without context",
+			searchBlock: "\treturn nil",
+			errContains: "multiple occurrences",
+		},
+		{
+			name:        "context before picks the second",
+			searchBlock: "\treturn nil",
+			before:      "func b() {",
+			want:        "func a() {\n\treturn nil\n}\n\nfunc b() {\n\treturn err\n}\n",
+		},
+		{
+			name:        "context after picks the first",
+			searchBlock: "\treturn nil",
+			after:       "}\n\nfunc b",
+			want:        "func a() {\n\treturn err\n}\n\nfunc b() {\n\treturn nil\n}\n",
+		},
+		{
+			name:        "search ending in newline",
+			searchBlock: "\treturn nil\n",
+			after:       "}\n\n",
+			want:        "func a() {\n\treturn err}\n\nfunc b() {\n\treturn nil\n}\n",
+		},
+		{
+			name:        "both contexts",
+			searchBlock: "\treturn nil",
+			before:      "func a() {",
+			after:       "}",
+			want:        "func a() {\n\treturn err\n}\n\nfunc b() {\n\treturn nil\n}\n",
+		},
+		{
+			name:        "contexts that disagree",
+			searchBlock: "\treturn nil",
+			before:      "func a() {",
+			after:       "}\n\nfunc a",
+			errContains: "search block not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := editOptions{contextBefore: tt.before, contextAfter: tt.after}
+			result, err := applyEdit(content, tt.searchBlock, "\treturn err", opts)
+
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("applyEdit() error = %v, want error containing %v", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditFuzzContext(t *testing.T) {
+	content := "a\nb\nc\n"
+
+	// The context rules out the only exact occurrence, and no fuzzy one
+	// has it either
+	_, err := applyEdit(content, "a\nb", "x", editOptions{fuzz: 1, contextAfter: "zzz"})
+	if !errors.Is(err, errSearchNotFound) {
+		t.Errorf("applyEdit() error = %v, want %v", err, errSearchNotFound)
+	}
+
+	content = "start\nx = 1\nend\nfirst\nstart\nx = 2\nend\nsecond\n"
+	result, err := applyEdit(content, "start\nx = 3\nend\n", "replaced\n", editOptions{fuzz: 1, contextAfter: "second"})
+	if err != nil {
+		t.Fatalf("applyEdit() error = %v", err)
+	}
+	if want := "start\nx = 1\nend\nfirst\nreplaced\nsecond\n"; result.content != want {
+		t.Errorf("applyEdit() = %q, want %q", result.content, want)
+	}
+}
+
+func TestFindMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		want    []span
+	}{
+		{name: "no match", content: "abc", search: "x", want: nil},
+		{name: "single", content: "one two three", search: "two", want: []span{{4, 7}}},
+		{name: "several", content: "foo\nbar\nfoo\nfoo", search: "foo", want: []span{{0, 3}, {8, 11}, {12, 15}}},
+		{name: "overlapping", content: "aaa", search: "aa", want: []span{{0, 2}, {1, 3}}},
+		{name: "overlapping lines", content: "x\nx\nx\n", search: "x\nx\n", want: []span{{0, 4}, {2, 6}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findMatches(tt.content, tt.search, editOptions{})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizedViewEquivalentIndent(t *testing.T) {
+	s := "\tif x {\n  \treturn\tnil\n}"
+	v := normalizedView(s, editOptions{equivalentIndent: true, tabWidth: 4})
+
+	if want := "    if x {\n    return\tnil\n}"; v.text != want {
+		t.Fatalf("text = %q, want %q", v.text, want)
+	}
+	if len(v.offsets) != len(v.text)+1 {
+		t.Fatalf("len(offsets) = %d, want %d", len(v.offsets), len(v.text)+1)
+	}
+}
+
+func TestApplyEditEquivalentIndent(t *testing.T) {
+	content := "func f() {\n\tif x {\n\t\treturn nil\n\t}\n}\n"
+
+	tests := []struct {
+		name        string
+		searchBlock string
+		tabWidth    int
+		want        string
+		errContains string
+	}{
+		{
+			name:        "spaces for tabs",
+			searchBlock: "    if x {\n        return nil\n    }",
+			tabWidth:    4,
+			want:        "func f() {\n\tREPLACED\n}\n",
+		},
+		{
+			name:        "mixed indentation",
+			searchBlock: "\tif x {\n    \treturn nil\n",
+			tabWidth:    4,
+			want:        "func f() {\n\tREPLACED\t}\n}\n",
+		},
+		{
+			name:        "different logical indent",
+			searchBlock: "  if x {\n",
+			tabWidth:    4,
+			errContains: "search block not found",
+		},
+		{
+			name:        "tab width matters",
+			searchBlock: "        if x {\n",
+			tabWidth:    8,
+			want:        "func f() {\n\tREPLACED\t\treturn nil\n\t}\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := editOptions{equivalentIndent: true, tabWidth: tt.tabWidth}
+			result, err := applyEdit(content, tt.searchBlock, "\tREPLACED", opts)
+
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("applyEdit() error = %v, want error containing %v", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditMatchReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		opts    editOptions
+		want    string
+	}{
+		{
+			name:    "exact",
+			content: "a\nb\nx\na\nb\n",
+			search:  "a\nb\n",
+			opts:    editOptions{matchReport: true},
+			want: "candidates:\n" +
+				"  lines 1-2: exact match, hash " + occurrenceHash("a\nb\nx\na\nb\n", span{0, 4})[:shownHashLength] + "\n" +
+				"  lines 4-5: exact match, hash " + occurrenceHash("a\nb\nx\na\nb\n", span{6, 10})[:shownHashLength] + "\n",
+		},
+		{
+			name:    "fuzzy",
+			content: "one\ntwo\nthree\n--\none\n2\nthree\n--\nuno\ndos\nthree\n",
+			search:  "one\ntwo-ish\nthree\n",
+			opts:    editOptions{matchReport: true, fuzz: 1},
+			want: "candidates:\n" +
+				"  lines 1-3: 67% similar, 2 of 3 lines match\n" +
+				"  lines 5-7: 67% similar, 2 of 3 lines match\n" +
+				"hint:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := applyEdit(tt.content, tt.search, "x", tt.opts)
+			if !errors.Is(err, errAmbiguous) {
+				t.Fatalf("applyEdit() error = %v, want errAmbiguous", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("applyEdit() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditAmbiguousOccurrences(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		want    string
+	}{
+		{
+			name:    "whole lines",
+			content: "x = 1\ny = 2\nx = 1\n",
+			search:  "x = 1\n",
+			want:    "\noccurrences:\n  line 1: \"x = 1\"\n  line 3: \"x = 1\"",
+		},
+		{
+			name:    "previews the whole first line",
+			content: "\tcall(foo)\nbar(foo)",
+			search:  "foo)",
+			want:    "\noccurrences:\n  line 1: \"call(foo)\"\n  line 2: \"bar(foo)\"",
+		},
+		{
+			name:    "long list is cut short",
+			content: strings.Repeat("x\n", 12),
+			search:  "x",
+			want:    "\n  line 10: \"x\"\n  and 2 more (--match-report lists them all)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := applyEdit(tt.content, tt.search, "z", editOptions{})
+			if !errors.Is(err, errAmbiguous) {
+				t.Fatalf("applyEdit() error = %v, want errAmbiguous", err)
+			}
+			if !strings.HasSuffix(err.Error(), tt.want) {
+				t.Errorf("applyEdit() error = %q, want it to end with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditWholeWord(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		replace string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "skips longer identifiers",
+			content: "foobar := foo(x)\n_foo = 1\n",
+			search:  "foo",
+			replace: "baz",
+			want:    "foobar := baz(x)\n_foo = 1\n",
+		},
+		{
+			name:    "standalone occurrences stay ambiguous",
+			content: "foo(foo)\n",
+			search:  "foo",
+			replace: "baz",
+			wantErr: errAmbiguous,
+		},
+		{
+			name:    "punctuation at the edges",
+			content: "a.foo() + b.foo\n",
+			search:  ".foo(",
+			replace: ".bar(",
+			want:    "a.bar() + b.foo\n",
+		},
+		{
+			name:    "unicode letters are word characters",
+			content: "éfoo foo\n",
+			search:  "foo",
+			replace: "bar",
+			want:    "éfoo bar\n",
+		},
+		{
+			name:    "no standalone occurrence",
+			content: "foobar\n",
+			search:  "foo",
+			replace: "baz",
+			wantErr: errSearchNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.search, tt.replace, editOptions{wholeWord: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyEdit() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditLineAnchored(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		replace string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "fragment matches are ignored",
+			content: "x = 1\nprint(x = 1)\n",
+			search:  "x = 1",
+			replace: "x = 2",
+			want:    "x = 2\nprint(x = 1)\n",
+		},
+		{
+			name:    "block spanning line fragments",
+			content: "a = b\nc = d\n",
+			search:  "b\nc",
+			replace: "z",
+			wantErr: errSearchNotFound,
+		},
+		{
+			name:    "last line without newline",
+			content: "one\ntwo",
+			search:  "two",
+			replace: "2",
+			want:    "one\n2",
+		},
+		{
+			name:    "several whole lines are ambiguous",
+			content: "x\ny\nx\n",
+			search:  "x\n",
+			replace: "z\n",
+			wantErr: errAmbiguous,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.search, tt.replace, editOptions{lineAnchored: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyEdit() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditTrailingNewline(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    trailingNewlineMode
+		content string
+		search  string
+		replace string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "strip matches a line prefix",
+			mode:    trailingNewlineStrip,
+			content: "x = 10\nx = 1\n",
+			search:  "x = 1",
+			replace: "x = 2",
+			wantErr: errAmbiguous,
+		},
+		{
+			name:    "keep needs the line break",
+			mode:    trailingNewlineKeep,
+			content: "x = 10\nx = 1\n",
+			search:  "x = 1",
+			replace: "x = 2",
+			want:    "x = 10\nx = 2\n",
+		},
+		{
+			name:    "keep misses the last line without newline",
+			mode:    trailingNewlineKeep,
+			content: "x = 10\nx = 1",
+			search:  "x = 1",
+			replace: "x = 2",
+			wantErr: errSearchNotFound,
+		},
+		{
+			name:    "auto uses the line break when unique",
+			mode:    trailingNewlineAuto,
+			content: "x = 10\nx = 1\n",
+			search:  "x = 1",
+			replace: "x = 2",
+			want:    "x = 10\nx = 2\n",
+		},
+		{
+			name:    "auto falls back to strip",
+			mode:    trailingNewlineAuto,
+			content: "y = 0\nx = 1",
+			search:  "x = 1",
+			replace: "x = 2",
+			want:    "y = 0\nx = 2",
+		},
+		{
+			name:    "auto deletion keeps the line break",
+			mode:    trailingNewlineAuto,
+			content: "a\nb\n",
+			search:  "a",
+			replace: "",
+			want:    "\nb\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.search, tt.replace, editOptions{trailingNewline: tt.mode})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyEdit() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditAnchorFirstLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		replace string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "first line unindented",
+			content: "func f() {\n\tif x {\n\t\treturn\n\t}\n}\n",
+			search:  "if x {\n\t\treturn\n",
+			replace: "if y {\n\t\treturn\n",
+			want:    "func f() {\n\tif y {\n\t\treturn\n\t}\n}\n",
+		},
+		{
+			name:    "first line over-indented",
+			content: "a:\n  b: 1\n  c: 2\n",
+			search:  "    b: 1\n  c: 2\n",
+			replace: "    b: 10\n  c: 2\n",
+			want:    "a:\n  b: 10\n  c: 2\n",
+		},
+		{
+			name:    "rest must match exactly",
+			content: "\tif x {\n\t\treturn\n",
+			search:  "if x {\n\treturn\n",
+			replace: "if y {\n\treturn\n",
+			wantErr: errSearchNotFound,
+		},
+		{
+			name:    "several indentations",
+			content: "\tx = 1\ny\n  x = 1\ny\n",
+			search:  "x = 1\ny\n",
+			replace: "x = 2\ny\n",
+			wantErr: errAmbiguous,
+		},
+		{
+			name:    "anchor must start a line",
+			content: "\tx = 1\nfoo x = 1\n",
+			search:  "  x = 1\n",
+			replace: "  x = 2\n",
+			want:    "\tx = 2\nfoo x = 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.search, tt.replace, editOptions{anchorFirstLine: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyEdit() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditTolerateBlankLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		replace string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "blank line removed",
+			content: "a\n\nb\nc\n",
+			search:  "a\nb\n",
+			replace: "x\n",
+			want:    "x\nc\n",
+		},
+		{
+			name:    "blank line inserted",
+			content: "a\nb\nc\n",
+			search:  "a\n\nb\n",
+			replace: "x\n",
+			want:    "x\nc\n",
+		},
+		{
+			name:    "whitespace-only line",
+			content: "a\n  \t\nb\n",
+			search:  "a\nb",
+			replace: "x",
+			want:    "x\n",
+		},
+		{
+			name:    "other lines still differ",
+			content: "a\n\nb\n",
+			search:  "a\nc\n",
+			replace: "x\n",
+			wantErr: errSearchNotFound,
+		},
+		{
+			name:    "blank lines make it ambiguous",
+			content: "a\nb\n\na\n\nb\n",
+			search:  "a\nb\n",
+			replace: "x\n",
+			wantErr: errAmbiguous,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.search, tt.replace, editOptions{tolerateBlankLines: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyEdit() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchStopsWhenCancelled(t *testing.T) {
+	content := "one\ntwo\nthree\n"
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts := editOptions{ctx: ctx}
+
+	if matches := findMatches(content, "two", opts); matches != nil {
+		t.Errorf("findMatches() = %v after cancellation, want none", matches)
+	}
+	if candidates := fuzzyCandidates(splitLines(content), []string{"one", "2"}, 1, opts); candidates != nil {
+		t.Errorf("fuzzyCandidates() = %v after cancellation, want none", candidates)
+	}
+	if matches := findMatches(content, "two", editOptions{}); len(matches) != 1 {
+		t.Errorf("findMatches() without a context found %d matches, want 1", len(matches))
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import "strings"
+
+// normalize converts text to the form used for matching and previews: CRLF
+// line endings become LF. Every comparison between a diff and file content
+// goes through it so that both sides follow the same rules.
+func normalize(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+// normalizeWith is normalize unless opts.noNormalize is set, in which case s
+// is left alone so that it is matched byte for byte.
+func normalizeWith(s string, opts editOptions) string {
+	if opts.noNormalize {
+		return s
+	}
+	return normalize(s)
+}
+
+// lineEnding returns the line ending s consistently uses: "\r\n" if every
+// line break in s is a CRLF, "\n" otherwise (including text without line
+// breaks).
+func lineEnding(s string) string {
+	lf := strings.Count(s, "\n")
+	if lf > 0 && strings.Count(s, "\r\n") == lf {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// denormalize is the inverse of normalize for text that is to be written back
+// to a file using the line ending eol.
+func denormalize(s, eol string) string {
+	s = normalize(s)
+	if eol == "\n" {
+		return s
+	}
+	return strings.ReplaceAll(s, "\n", eol)
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestLineEnding(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"lf", "a\nb\n", "\n"},
+		{"crlf", "a\r\nb\r\n", "\r\n"},
+		{"mixed", "a\r\nb\n", "\n"},
+		{"no_line_breaks", "a", "\n"},
+		{"empty", "", "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineEnding(tt.content); got != tt.want {
+				t.Errorf("lineEnding(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenormalize(t *testing.T) {
+	original := "a\r\nb\r\n"
+	edited := normalize(original) + "c\r\nd\n"
+	if got, want := denormalize(edited, lineEnding(original)), "a\r\nb\r\nc\r\nd\r\n"; got != want {
+		t.Errorf("denormalize() = %q, want %q", got, want)
+	}
+	if got, want := denormalize("a\r\nb\n", "\n"), "a\nb\n"; got != want {
+		t.Errorf("denormalize() to LF = %q, want %q", got, want)
+	}
+}
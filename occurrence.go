@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// occurrenceContextLines is how many lines on each side of an occurrence its
+// hash covers.
+const occurrenceContextLines = 2
+
+// minHashPrefix is the shortest prefix of an occurrence hash accepted by
+// --occurrence-hash.
+const minHashPrefix = 8
+
+// shownHashLength is how much of an occurrence hash is shown in reports.
+const shownHashLength = 12
+
+// occurrenceHash identifies an occurrence by its surroundings: the hex SHA-256
+// of the lines from occurrenceContextLines before it to occurrenceContextLines
+// after it, fewer near the ends of the file. It doesn't depend on line
+// numbers, so it stays the same when lines are added elsewhere in the file.
+func occurrenceHash(content string, m span) string {
+	start, end, _ := widenByLines(content, m, occurrenceContextLines)
+	return sha256Hex([]byte(content[start:end]))
+}
+
+// checkHashPrefix validates the value of --occurrence-hash.
+func checkHashPrefix(hash string) error {
+	if len(hash) < minHashPrefix || strings.Trim(strings.ToLower(hash), "0123456789abcdef") != "" {
+		return fmt.Errorf("occurrence hash %q must be at least %d hex digits", hash, minHashPrefix)
+	}
+	return nil
+}
+
+// pickByHash returns the one occurrence whose hash starts with hash.
+func pickByHash(content string, matches []span, hash string) (span, error) {
+	hash = strings.ToLower(hash)
+	var picked []span
+	for _, m := range matches {
+		if strings.HasPrefix(occurrenceHash(content, m), hash) {
+			picked = append(picked, m)
+		}
+	}
+	switch len(picked) {
+	case 1:
+		return picked[0], nil
+	case 0:
+		return span{}, fmt.Errorf("no occurrence of the search block has hash %s\n%s", hash, hashList(content, matches))
+	}
+	return span{}, fmt.Errorf("%w - %d occurrences have hash %s", errAmbiguous, len(picked), hash)
+}
+
+// hashList shows the line and hash of each occurrence.
+func hashList(content string, matches []span) string {
+	var b strings.Builder
+	b.WriteString("occurrences:")
+	for _, m := range matches {
+		fmt.Fprintf(&b, "\n  line %d: hash %s", strings.Count(content[:m.start], "\n")+1, occurrenceHash(content, m)[:shownHashLength])
+	}
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestApplyEditOccurrenceHash(t *testing.T) {
+	content := "a\nx = 1\nb\nc\nd\ne\nx = 1\nf\n"
+	second := strings.LastIndex(content, "x = 1")
+	hash := occurrenceHash(content, span{second, second + len("x = 1")})
+
+	tests := []struct {
+		name    string
+		hash    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "full hash",
+			hash: hash,
+			want: "a\nx = 1\nb\nc\nd\ne\nx = 2\nf\n",
+		},
+		{
+			name: "prefix",
+			hash: strings.ToUpper(hash[:minHashPrefix]),
+			want: "a\nx = 1\nb\nc\nd\ne\nx = 2\nf\n",
+		},
+		{
+			name:    "no occurrence has the hash",
+			hash:    "00000000",
+			wantErr: "no occurrence of the search block has hash 00000000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(content, "x = 1", "x = 2", editOptions{occurrenceHash: tt.hash})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyEdit() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestOccurrenceHashIgnoresLineNumbers(t *testing.T) {
+	content := "p\nq\nx = 1\nr\ns\n"
+	m := span{4, 9}
+	moved := "new\nlines\n" + content
+	if occurrenceHash(content, m) != occurrenceHash(moved, span{m.start + 10, m.end + 10}) {
+		t.Error("occurrenceHash() changed when lines were added before the context")
+	}
+}
+
+func TestPickByHashIdenticalContext(t *testing.T) {
+	content := "p\nq\nx\nr\ns\np\nq\nx\nr\ns\n"
+	m := span{4, 5}
+	_, err := pickByHash(content, []span{m, {14, 15}}, occurrenceHash(content, m))
+	if !errors.Is(err, errAmbiguous) {
+		t.Errorf("pickByHash() error = %v, want errAmbiguous", err)
+	}
+}
+
+func TestCheckHashPrefix(t *testing.T) {
+	for _, hash := range []string{"0123abcd", "0123ABCDef"} {
+		if err := checkHashPrefix(hash); err != nil {
+			t.Errorf("checkHashPrefix(%q) error = %v", hash, err)
+		}
+	}
+	for _, hash := range []string{"0123abc", "0123abcg"} {
+		if err := checkHashPrefix(hash); err == nil {
+			t.Errorf("checkHashPrefix(%q) succeeded, want an error", hash)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func preserveOwner(filename string, info os.FileInfo) {}
@@ -0,0 +1,40 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWriteFileAtomicPreservesOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing file ownership requires root")
+	}
+
+	filename := filepath.Join(t.TempDir(), "owned.txt")
+	if err := os.WriteFile(filename, []byte("old"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(filename, 1234, 5678); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(filename, []byte("new"), false); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	if stat.Uid != 1234 || stat.Gid != 5678 {
+		t.Errorf("owner = %d:%d, want 1234:5678", stat.Uid, stat.Gid)
+	}
+	if mode := info.Mode().Perm(); mode != 0640 {
+		t.Errorf("mode = %v, want %v", mode, os.FileMode(0640))
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwner restores the uid and gid recorded in info on filename. Errors
+// are ignored since only privileged users may give files away.
+func preserveOwner(filename string, info os.FileInfo) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	os.Chown(filename, int(stat.Uid), int(stat.Gid))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// defaultPager is used for --pager when $PAGER is not set.
+const defaultPager = "less -R"
+
+// isTerminal reports whether f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// startPager runs the user's pager with its output going to out and returns
+// a writer for its input. The returned function closes the input and waits
+// for the pager to exit.
+func startPager(out io.Writer) (io.Writer, func() error, error) {
+	command := strings.Fields(os.Getenv("PAGER"))
+	if len(command) == 0 {
+		command = strings.Fields(defaultPager)
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	wait := func() error {
+		stdin.Close()
+		return cmd.Wait()
+	}
+	return stdin, wait, nil
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStartPager(t *testing.T) {
+	t.Setenv("PAGER", "cat")
+
+	var out strings.Builder
+	w, wait, err := startPager(&out)
+	if err != nil {
+		t.Fatalf("startPager() error = %v", err)
+	}
+	fmt.Fprintln(w, "preview")
+	if err := wait(); err != nil {
+		t.Fatalf("pager exited with %v", err)
+	}
+	if out.String() != "preview\n" {
+		t.Errorf("pager output = %q, want %q", out.String(), "preview\n")
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if isTerminal(f) {
+		t.Error("isTerminal() = true for a regular file")
+	}
+}
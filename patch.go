@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writePatch prints the change from before to after as a unified diff that
+// patch and git apply accept. The change is one hunk spanning the lines from
+// the first to the last that differ, with defaultContextLines of context. A
+// created file is diffed against /dev/null.
+func writePatch(w io.Writer, filename, before, after string, created bool) {
+	a, b := patchLines(before), patchLines(after)
+	prefix, suffix := sharedEnds(a, b)
+	if prefix == len(a) && prefix == len(b) {
+		return
+	}
+
+	first := max(prefix-defaultContextLines, 0)
+	context := min(suffix, defaultContextLines)
+	oldEnd, newEnd := len(a)-suffix+context, len(b)-suffix+context
+
+	from := filename
+	if created {
+		from = "/dev/null"
+	}
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", from, filename)
+	fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(first, oldEnd-first), hunkRange(first, newEnd-first))
+	for _, line := range a[first:prefix] {
+		writePatchLine(w, ' ', line)
+	}
+	for _, line := range a[prefix : len(a)-suffix] {
+		writePatchLine(w, '-', line)
+	}
+	for _, line := range b[prefix : len(b)-suffix] {
+		writePatchLine(w, '+', line)
+	}
+	for _, line := range a[len(a)-suffix : oldEnd] {
+		writePatchLine(w, ' ', line)
+	}
+}
+
+// sharedEnds returns how many lines a and b share at the start and, after
+// those, at the end.
+func sharedEnds(a, b []string) (prefix, suffix int) {
+	for prefix < min(len(a), len(b)) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < min(len(a), len(b))-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	return prefix, suffix
+}
+
+// lineChanges counts the lines removed from before and added in after,
+// taking every line between the first and the last that differ as changed,
+// like the hunk of writePatch.
+func lineChanges(before, after string) (removed, added int) {
+	a, b := patchLines(before), patchLines(after)
+	prefix, suffix := sharedEnds(a, b)
+	return len(a) - prefix - suffix, len(b) - prefix - suffix
+}
+
+// patchLines splits s into lines that keep their newline, so that a last
+// line without one compares different from the same line with one.
+func patchLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// hunkRange formats the range of count lines after line first (0-based) for
+// a hunk header. An empty range names the line before it, as diff does.
+func hunkRange(first, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", first)
+	}
+	return fmt.Sprintf("%d,%d", first+1, count)
+}
+
+func writePatchLine(w io.Writer, marker byte, line string) {
+	if text, ok := strings.CutSuffix(line, "\n"); ok {
+		fmt.Fprintf(w, "%c%s\n", marker, text)
+		return
+	}
+	fmt.Fprintf(w, "%c%s\n\\ No newline at end of file\n", marker, line)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWritePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  string
+		after   string
+		created bool
+		want    string
+	}{
+		{
+			name:   "changed line with context",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			after:  "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want:   "--- f.txt\n+++ f.txt\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name:   "inserted lines",
+			before: "a\nb\n",
+			after:  "a\nx\ny\nb\n",
+			want:   "--- f.txt\n+++ f.txt\n@@ -1,2 +1,4 @@\n a\n+x\n+y\n b\n",
+		},
+		{
+			name:   "no newline at end of file",
+			before: "a\nb",
+			after:  "a\nc",
+			want:   "--- f.txt\n+++ f.txt\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			name:    "created file",
+			before:  "",
+			after:   "new\n",
+			created: true,
+			want:    "--- /dev/null\n+++ f.txt\n@@ -0,0 +1,1 @@\n+new\n",
+		},
+		{
+			name:   "unchanged",
+			before: "same\n",
+			after:  "same\n",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			writePatch(&buf, "f.txt", tt.before, tt.after, tt.created)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("writePatch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineChanges(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		removed       int
+		added         int
+	}{
+		{"one line changed", "a\nb\nc\n", "a\nB\nc\n", 1, 1},
+		{"lines inserted", "a\nc\n", "a\nb1\nb2\nc\n", 0, 2},
+		{"lines deleted", "a\nb\nc\nd\n", "a\nd\n", 2, 0},
+		{"changes far apart", "a\nb\nc\nd\n", "A\nb\nc\nD\n", 4, 4},
+		{"final newline added", "a\nb", "a\nb\n", 1, 1},
+		{"unchanged", "a\n", "a\n", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed, added := lineChanges(tt.before, tt.after)
+			if removed != tt.removed || added != tt.added {
+				t.Errorf("lineChanges() = -%d +%d, want -%d +%d", removed, added, tt.removed, tt.added)
+			}
+		})
+	}
+}
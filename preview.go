@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// defaultContextLines is the number of unchanged lines shown around the
+// affected region in previews.
+const defaultContextLines = 3
+
+// preview is the affected region of an edit before and after it is applied,
+// padded with surrounding context lines.
+type preview struct {
+	matchLine int
+	before    []string
+	after     []string
+	context   [2][]string // lines preceding and following the region
+}
+
+// Result statuses reported in JSON output.
+const (
+	statusApplied   = "applied"
+	statusPreview   = "preview"
+	statusUnchanged = "unchanged"
+	statusSkipped   = "skipped"
+	statusError     = "error"
+)
+
+// jsonSchemaVersion is the version of the jsonResult shape. It is bumped
+// whenever a field is renamed or removed or its meaning changes, so that
+// consumers can detect output they don't understand.
+const jsonSchemaVersion = 1
+
+// jsonResult is the structured result printed with --json and in server
+// mode. Every JSON output of the tool uses this one shape.
+type jsonResult struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	File          string `json:"file"`
+	Status        string `json:"status"`
+	MatchLine     int    `json:"matchLine"`
+	MatchColumn   int    `json:"matchColumn"`
+	Before        string `json:"before"`
+	After         string `json:"after"`
+	Applied       bool   `json:"applied"`
+	Error         string `json:"error,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+	SkippedBlocks []int  `json:"skippedBlocks,omitempty"`
+	SHA256        string `json:"sha256,omitempty"`
+	// LinesRemoved, LinesAdded and NetLines are set with
+	// --count-lines-changed.
+	LinesRemoved *int `json:"linesRemoved,omitempty"`
+	LinesAdded   *int `json:"linesAdded,omitempty"`
+	NetLines     *int `json:"netLines,omitempty"`
+}
+
+func newJSONResult(filename string, result editResult, opts runOptions) jsonResult {
+	p := newPreview(result, opts.contextLines)
+	line, column := matchPosition(result, opts.position)
+	status := statusApplied
+	switch {
+	case result.skipped != "":
+		status = statusSkipped
+	case result.unchanged:
+		status = statusUnchanged
+	case opts.dryRun:
+		status = statusPreview
+	}
+	r := jsonResult{
+		SchemaVersion: jsonSchemaVersion,
+		File:          filename,
+		Status:        status,
+		MatchLine:     line,
+		MatchColumn:   column,
+		Before:        p.beforeText(),
+		After:         p.afterText(),
+		Applied:       status == statusApplied,
+		Reason:        result.skipped,
+		SkippedBlocks: result.skippedBlocks(),
+		SHA256:        result.sha256,
+	}
+	if opts.countLines && result.skipped == "" {
+		net := result.linesAdded - result.linesRemoved
+		r.LinesRemoved, r.LinesAdded, r.NetLines = &result.linesRemoved, &result.linesAdded, &net
+	}
+	return r
+}
+
+// positionFormat is how match positions are reported, to suit the editor
+// consuming them.
+type positionFormat struct {
+	// zeroBased numbers lines and columns from 0 instead of 1.
+	zeroBased bool
+	// runes counts columns in characters instead of bytes.
+	runes bool
+	// utf16 counts columns in UTF-16 code units, as LSP does by default.
+	utf16 bool
+}
+
+// matchPosition returns the line and column where the match of result starts
+// in the original content.
+func matchPosition(result editResult, format positionFormat) (line, column int) {
+	return offsetPosition(result.original, result.start, format)
+}
+
+// offsetPosition returns the line and column of the byte offset in content.
+func offsetPosition(content string, offset int, format positionFormat) (line, column int) {
+	before := content[:offset]
+	lineStart := strings.LastIndex(before, "\n") + 1
+	column = len(before) - lineStart
+	switch {
+	case format.utf16:
+		column = len(utf16.Encode([]rune(before[lineStart:])))
+	case format.runes:
+		column = utf8.RuneCountInString(before[lineStart:])
+	}
+	base := 1
+	if format.zeroBased {
+		base = 0
+	}
+	return strings.Count(before, "\n") + base, column + base
+}
+
+// errorResult is the JSON result for an edit that failed.
+func errorResult(filename string, err error) jsonResult {
+	return jsonResult{SchemaVersion: jsonSchemaVersion, File: filename, Status: statusError, Error: err.Error()}
+}
+
+func newPreview(result editResult, contextLines int) preview {
+	ls, le := lineBounds(result.original, result.start, result.end)
+	newLe := le + len(result.replacement) - (result.end - result.start)
+
+	if contextLines < 0 {
+		contextLines = 0
+	}
+
+	leading := splitLines(result.original[:ls])
+	trailing := splitLines(result.original[le:])
+	if len(leading) > contextLines {
+		leading = leading[len(leading)-contextLines:]
+	}
+	if len(trailing) > contextLines {
+		trailing = trailing[:contextLines]
+	}
+
+	return preview{
+		matchLine: strings.Count(result.original[:result.start], "\n") + 1,
+		before:    splitLines(result.original[ls:le]),
+		after:     splitLines(result.content[ls:newLe]),
+		context:   [2][]string{leading, trailing},
+	}
+}
+
+// lineBounds expands the byte range [start, end) of s to cover whole lines,
+// including the newline that terminates the last one.
+func lineBounds(s string, start, end int) (int, int) {
+	ls := strings.LastIndex(s[:start], "\n") + 1
+	if end > start && s[end-1] == '\n' {
+		return ls, end
+	}
+	le := strings.Index(s[end:], "\n")
+	if le == -1 {
+		return ls, len(s)
+	}
+	return ls, end + le + 1
+}
+
+// splitLines splits s into lines, dropping the empty element produced by a
+// trailing newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func (p preview) beforeText() string {
+	return joinLines(p.context[0], p.before, p.context[1])
+}
+
+func (p preview) afterText() string {
+	return joinLines(p.context[0], p.after, p.context[1])
+}
+
+func joinLines(groups ...[]string) string {
+	var lines []string
+	for _, group := range groups {
+		lines = append(lines, group...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writePreview prints the region as a unified-diff style hunk. With
+// lineNumbers set, each line is prefixed with its line number: removed lines
+// use the original numbering, added and trailing lines the projected one.
+func writePreview(w io.Writer, filename string, p preview, lineNumbers bool) {
+	start := writeHunkHeader(w, filename, p)
+
+	width := len(fmt.Sprint(p.matchLine + max(len(p.before), len(p.after)) + len(p.context[1])))
+	printLine := func(n int, marker byte, line string) {
+		if lineNumbers {
+			fmt.Fprintf(w, "%*d %c%s\n", width, n, marker, line)
+		} else {
+			fmt.Fprintf(w, "%c%s\n", marker, line)
+		}
+	}
+
+	for i, line := range p.context[0] {
+		printLine(start+i, ' ', line)
+	}
+	for i, line := range p.before {
+		printLine(p.matchLine+i, '-', line)
+	}
+	for i, line := range p.after {
+		printLine(p.matchLine+i, '+', line)
+	}
+	for i, line := range p.context[1] {
+		printLine(p.matchLine+len(p.after)+i, ' ', line)
+	}
+}
+
+// writeHunkHeader prints the file and hunk header lines of the preview and
+// returns the number of its first line.
+func writeHunkHeader(w io.Writer, filename string, p preview) int {
+	start := p.matchLine - len(p.context[0])
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", filename, filename)
+	fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", start, len(p.context[0])+len(p.before)+len(p.context[1]),
+		start, len(p.context[0])+len(p.after)+len(p.context[1]))
+	return start
+}
+
+// writeMatch prints the exact text that was matched, prefixed with the line
+// numbers it spans in the original file.
+func writeMatch(w io.Writer, filename string, result editResult) {
+	first := strings.Count(result.original[:result.start], "\n") + 1
+	lines := strings.Split(strings.TrimSuffix(result.original[result.start:result.end], "\n"), "\n")
+	last := first + len(lines) - 1
+
+	fmt.Fprintf(w, "Matched %s lines %d-%d:\n", filename, first, last)
+	width := len(fmt.Sprint(last))
+	for i, line := range lines {
+		fmt.Fprintf(w, "%*d | %s\n", width, first+i, line)
+	}
+}
+
+func writeJSON(w io.Writer, result jsonResult) error {
+	encoder := json.NewEncoder(w)
+	return encoder.Encode(result)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewPreview(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		searchBlock  string
+		replaceBlock string
+		contextLines int
+		wantLine     int
+		wantBefore   string
+		wantAfter    string
+	}{
+		{
+			name:         "replacement in the middle",
+			content:      "a\nb\nc\nd\ne\nf\ng",
+			searchBlock:  "d",
+			replaceBlock: "D1\nD2",
+			contextLines: 2,
+			wantLine:     4,
+			wantBefore:   "b\nc\nd\ne\nf",
+			wantAfter:    "b\nc\nD1\nD2\ne\nf",
+		},
+		{
+			name:         "context clamped at file start",
+			content:      "first\nsecond\nthird",
+			searchBlock:  "first",
+			replaceBlock: "1st",
+			contextLines: 3,
+			wantLine:     1,
+			wantBefore:   "first\nsecond\nthird",
+			wantAfter:    "1st\nsecond\nthird",
+		},
+		{
+			name:         "whole line deletion",
+			content:      "keep\ndelete\nkeep too\n",
+			searchBlock:  "delete\n",
+			replaceBlock: "",
+			contextLines: 1,
+			wantLine:     2,
+			wantBefore:   "keep\ndelete\nkeep too",
+			wantAfter:    "keep\nkeep too",
+		},
+		{
+			name:         "context clamped at file end",
+			content:      "first\nsecond\nthird\n",
+			searchBlock:  "third",
+			replaceBlock: "3rd",
+			contextLines: 5,
+			wantLine:     3,
+			wantBefore:   "first\nsecond\nthird",
+			wantAfter:    "first\nsecond\n3rd",
+		},
+		{
+			name:         "negative context",
+			content:      "first\nsecond\nthird",
+			searchBlock:  "second",
+			replaceBlock: "2nd",
+			contextLines: -1,
+			wantLine:     2,
+			wantBefore:   "second",
+			wantAfter:    "2nd",
+		},
+		{
+			name:         "partial line match",
+			content:      "x := oldName()\ny := 1",
+			searchBlock:  "oldName",
+			replaceBlock: "newName",
+			contextLines: 0,
+			wantLine:     1,
+			wantBefore:   "x := oldName()",
+			wantAfter:    "x := newName()",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.searchBlock, tt.replaceBlock, editOptions{})
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+
+			p := newPreview(result, tt.contextLines)
+			if p.matchLine != tt.wantLine {
+				t.Errorf("matchLine = %d, want %d", p.matchLine, tt.wantLine)
+			}
+			if got := p.beforeText(); got != tt.wantBefore {
+				t.Errorf("beforeText() = %q, want %q", got, tt.wantBefore)
+			}
+			if got := p.afterText(); got != tt.wantAfter {
+				t.Errorf("afterText() = %q, want %q", got, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestLineBounds(t *testing.T) {
+	s := "one\ntwo\nthree"
+	tests := []struct {
+		start, end int
+		want       [2]int
+	}{
+		{start: 0, end: 3, want: [2]int{0, 4}},
+		{start: 5, end: 6, want: [2]int{4, 8}},
+		{start: 4, end: 8, want: [2]int{4, 8}},
+		{start: 9, end: 13, want: [2]int{8, 13}},
+	}
+
+	for _, tt := range tests {
+		ls, le := lineBounds(s, tt.start, tt.end)
+		if got := [2]int{ls, le}; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lineBounds(%d, %d) = %v, want %v", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestWritePreviewLineNumbers(t *testing.T) {
+	result, err := applyEdit("a\nb\nc\nd", "b", "B1\nB2", editOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	writePreview(&buf, "f.txt", newPreview(result, 1), true)
+
+	want := `--- f.txt
++++ f.txt
+@@ -1,3 +1,4 @@
+1  a
+2 -b
+2 +B1
+3 +B2
+4  c
+`
+	if got := buf.String(); got != want {
+		t.Errorf("writePreview() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteMatch(t *testing.T) {
+	content := strings.Repeat("filler\n", 9) + "start\n\tbody\nend\n"
+	result, err := applyEdit(content, "start\n\tbody\nend\n", "replaced\n", editOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	writeMatch(&buf, "f.txt", result)
+
+	want := "Matched f.txt lines 10-12:\n10 | start\n11 | \tbody\n12 | end\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeMatch() = %q, want %q", got, want)
+	}
+}
+
+func TestMatchPosition(t *testing.T) {
+	result, err := applyEdit("first\nnaïve café\n", "café", "tea", editOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		format     positionFormat
+		wantLine   int
+		wantColumn int
+	}{
+		{"one_based_bytes", positionFormat{}, 2, 8},
+		{"one_based_runes", positionFormat{runes: true}, 2, 7},
+		{"zero_based_bytes", positionFormat{zeroBased: true}, 1, 7},
+		{"zero_based_runes", positionFormat{zeroBased: true, runes: true}, 1, 6},
+		{"one_based_utf16", positionFormat{utf16: true}, 2, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, column := matchPosition(result, tt.format)
+			if line != tt.wantLine || column != tt.wantColumn {
+				t.Errorf("matchPosition() = %d:%d, want %d:%d", line, column, tt.wantLine, tt.wantColumn)
+			}
+		})
+	}
+}
+
+func TestJSONResultSchema(t *testing.T) {
+	result, err := applyEdit("a\nb\n", "b", "c", editOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := func(r jsonResult) map[string]any {
+		var buf strings.Builder
+		if err := writeJSON(&buf, r); err != nil {
+			t.Fatal(err)
+		}
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(buf.String()), &fields); err != nil {
+			t.Fatal(err)
+		}
+		return fields
+	}
+
+	applied := keys(newJSONResult("f.txt", result, runOptions{}))
+	failed := keys(errorResult("f.txt", errors.New("boom")))
+	for name, fields := range map[string]map[string]any{"applied": applied, "error": failed} {
+		if fields["schemaVersion"] != float64(jsonSchemaVersion) {
+			t.Errorf("%s result schemaVersion = %v, want %d", name, fields["schemaVersion"], jsonSchemaVersion)
+		}
+	}
+
+	// Apart from the error message, both results have the same fields
+	delete(failed, "error")
+	for key := range applied {
+		if _, ok := failed[key]; !ok {
+			t.Errorf("error result is missing field %q", key)
+		}
+	}
+	if len(applied) != len(failed) {
+		t.Errorf("applied result has %d fields, error result %d", len(applied), len(failed))
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// resolveUnderRoot resolves a file name from a manifest, server request or
+// delimited stream against root. Without a root, name is used as is. The
+// result must stay within root unless allowOutside is set; symbolic links are
+// not followed.
+func resolveUnderRoot(root, name string, allowOutside bool) (string, error) {
+	if root == "" {
+		return name, nil
+	}
+	resolved := name
+	if !filepath.IsAbs(name) {
+		resolved = filepath.Join(root, name)
+	}
+	if allowOutside {
+		return resolved, nil
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file %s is outside the root %s; use --allow-outside-root to edit it anyway", name, root)
+	}
+	return resolved, nil
+}
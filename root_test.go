@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveUnderRoot(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "checkout")
+	tests := []struct {
+		name         string
+		root         string
+		file         string
+		allowOutside bool
+		want         string
+		errContains  string
+	}{
+		{name: "no root", file: "../app.py", want: "../app.py"},
+		{name: "relative", root: root, file: "src/app.py", want: filepath.Join(root, "src", "app.py")},
+		{name: "dot segments inside", root: root, file: "src/../lib/app.py", want: filepath.Join(root, "lib", "app.py")},
+		{name: "absolute inside", root: root, file: filepath.Join(root, "app.py"), want: filepath.Join(root, "app.py")},
+		{name: "escape", root: root, file: "../other/app.py", errContains: "outside the root"},
+		{name: "absolute outside", root: root, file: filepath.Join(string(filepath.Separator), "etc", "passwd"), errContains: "outside the root"},
+		{name: "sibling with same prefix", root: root, file: "../checkout2/app.py", errContains: "outside the root"},
+		{name: "escape allowed", root: root, file: "../other/app.py", allowOutside: true, want: filepath.Join(string(filepath.Separator), "other", "app.py")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveUnderRoot(tt.root, tt.file, tt.allowOutside)
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("resolveUnderRoot() error = %v, want error containing %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveUnderRoot() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveUnderRoot() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelimitedJobsRoot(t *testing.T) {
+	root := t.TempDir()
+	a := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(a, []byte("old name\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := "file: a.txt\n<<<<<<< SEARCH\nold name\n=======\nnew name\n>>>>>>> REPLACE\n---\n" +
+		"file: ../../etc/passwd\n<<<<<<< SEARCH\nroot\n=======\nx\n>>>>>>> REPLACE\n"
+	jobs, err := delimitedJobs(input, "---", nil, runOptions{root: root})
+	if err != nil {
+		t.Fatalf("delimitedJobs() error = %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("got %d jobs, want 2", len(jobs))
+	}
+	if jobs[0].filename != a || jobs[0].err != nil {
+		t.Errorf("jobs[0] = %+v, want a ready job for %s", jobs[0], a)
+	}
+	if jobs[1].err == nil || !strings.Contains(jobs[1].err.Error(), "outside the root") {
+		t.Errorf("jobs[1] error = %v, want an outside the root error", jobs[1].err)
+	}
+
+	if _, err := editFile(jobs[0].filename, jobs[0].edit, runOptions{}); err != nil {
+		t.Fatalf("editFile() error = %v", err)
+	}
+	assertFileContent(t, a, "new name\n")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// serverRequest is a single edit read from stdin in server mode.
+type serverRequest struct {
+	File    string `json:"file"`
+	Search  string `json:"search"`
+	Replace string `json:"replace"`
+}
+
+// runServer reads newline-delimited JSON edit requests from r and writes one
+// JSON result per request to w until r is exhausted. A failing request is
+// reported in its result and does not stop the loop.
+func runServer(r io.Reader, w io.Writer, opts runOptions) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if strings.TrimSpace(line) != "" {
+			if err := writeJSON(w, handleRequest(line, opts)); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func handleRequest(line string, opts runOptions) jsonResult {
+	var req serverRequest
+	if err := json.Unmarshal([]byte(line), &req); err != nil {
+		return errorResult("", fmt.Errorf("invalid request: %w", err))
+	}
+	if req.File == "" {
+		return errorResult("", errors.New("invalid request: missing file"))
+	}
+	if req.Search == "" {
+		return errorResult(req.File, errors.New("invalid request: missing search text"))
+	}
+
+	filename, err := resolveUnderRoot(opts.root, req.File, opts.allowOutside)
+	if err != nil {
+		return errorResult(req.File, err)
+	}
+	replaceBlock, err := transformReplace(req.Replace, opts)
+	if err != nil {
+		return errorResult(filename, err)
+	}
+	result, err := editFile(filename, searchReplace(req.Search, replaceBlock, opts.edit), opts)
+	if err != nil {
+		return errorResult(filename, err)
+	}
+	return newJSONResult(filename, result, opts)
+}
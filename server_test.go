@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunServer(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.txt")
+	if err := os.WriteFile(good, []byte("hello world\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := []string{
+		`{"file":` + quote(good) + `,"search":"hello","replace":"goodbye"}`,
+		`not json`,
+		``,
+		`{"file":` + quote(filepath.Join(dir, "missing.txt")) + `,"search":"x","replace":"y"}`,
+		`{"file":` + quote(good) + `,"search":"goodbye","replace":"hi"}`,
+	}
+
+	var out strings.Builder
+	if err := runServer(strings.NewReader(strings.Join(requests, "\n")), &out, runOptions{}); err != nil {
+		t.Fatalf("runServer() error = %v", err)
+	}
+
+	var results []jsonResult
+	decoder := json.NewDecoder(strings.NewReader(out.String()))
+	for decoder.More() {
+		var result jsonResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want 4:\n%s", len(results), out.String())
+	}
+	if !results[0].Applied || results[0].Status != statusApplied || results[0].Error != "" {
+		t.Errorf("first request: got %+v, want applied", results[0])
+	}
+	if !strings.Contains(results[1].Error, "invalid request") {
+		t.Errorf("second request: error = %q, want invalid request", results[1].Error)
+	}
+	if results[2].Applied || results[2].Status != statusError || !strings.Contains(results[2].Error, "reading file") {
+		t.Errorf("third request: got %+v, want read error", results[2])
+	}
+	if !results[3].Applied {
+		t.Errorf("fourth request: got %+v, want applied", results[3])
+	}
+
+	got, err := os.ReadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hi world\n" {
+		t.Errorf("content = %q, want %q", got, "hi world\n")
+	}
+}
+
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"runtime/debug"
+	"time"
+)
+
+// version is the version of the tool, set at build time with
+// -ldflags "-X main.version=...". Without it, the module version from the
+// build info is used.
+var version string
+
+// toolVersion returns the version reported in summaries.
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// jsonSummary is the single JSON document printed at the end of a batch with
+// --summary-json.
+type jsonSummary struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	Version       string         `json:"version"`
+	ElapsedMs     int64          `json:"elapsedMs"`
+	Counts        map[string]int `json:"counts"`
+	Replacements  int            `json:"replacements"`
+	Files         []jsonResult   `json:"files"`
+}
+
+func newJSONSummary(files []jsonResult, replacements int, elapsed time.Duration) jsonSummary {
+	counts := map[string]int{}
+	for _, file := range files {
+		counts[file.Status]++
+	}
+	if files == nil {
+		files = []jsonResult{}
+	}
+	return jsonSummary{
+		SchemaVersion: jsonSchemaVersion,
+		Version:       toolVersion(),
+		ElapsedMs:     elapsed.Milliseconds(),
+		Counts:        counts,
+		Replacements:  replacements,
+		Files:         files,
+	}
+}
+
+// replacements is the number of blocks an edit applied, or would apply in a
+// dry run.
+func replacements(result editResult) int {
+	switch {
+	case result.unchanged:
+		return 0
+	case result.blocks != nil:
+		return len(result.blocks) - len(result.skippedBlocks())
+	}
+	return 1
+}
+
+func writeJSONSummary(w io.Writer, summary jsonSummary) error {
+	encoder := json.NewEncoder(w)
+	return encoder.Encode(summary)
+}
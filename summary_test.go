@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewJSONSummary(t *testing.T) {
+	files := []jsonResult{
+		{File: "a.go", Status: statusApplied},
+		{File: "b.go", Status: statusApplied},
+		{File: "c.go", Status: statusUnchanged},
+		errorResult("d.go", errors.New("boom")),
+	}
+	summary := newJSONSummary(files, 3, 1500*time.Millisecond)
+
+	want := map[string]int{statusApplied: 2, statusUnchanged: 1, statusError: 1}
+	if !reflect.DeepEqual(summary.Counts, want) {
+		t.Errorf("Counts = %v, want %v", summary.Counts, want)
+	}
+	if summary.ElapsedMs != 1500 || summary.Replacements != 3 || summary.Version == "" {
+		t.Errorf("newJSONSummary() = %+v", summary)
+	}
+
+	var buf strings.Builder
+	if err := writeJSONSummary(&buf, newJSONSummary(nil, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"files":[]`) {
+		t.Errorf("empty summary = %s, want an empty files array", buf.String())
+	}
+}
+
+func TestReplacements(t *testing.T) {
+	tests := []struct {
+		name   string
+		result editResult
+		want   int
+	}{
+		{"single block", editResult{}, 1},
+		{"unchanged", editResult{unchanged: true}, 0},
+		{"blocks", editResult{blocks: make([]blockOutcome, 3)}, 3},
+		{"skipped block", editResult{blocks: []blockOutcome{{}, {err: errSearchNotFound}}}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replacements(tt.result); got != tt.want {
+				t.Errorf("replacements() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
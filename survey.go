@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// surveyEntry is whether the edit would apply to one file of a survey.
+type surveyEntry struct {
+	filename string
+	status   string
+	err      error
+}
+
+// Survey statuses, in the order they are counted in the verdict.
+const (
+	surveyApplies   = "applies"
+	surveyPartial   = "partial"
+	surveyNotFound  = "not found"
+	surveyAmbiguous = "ambiguous"
+	surveyFailed    = "failed"
+)
+
+// runSurvey reports for every job whether its edit would apply, without
+// writing anything, and returns the exit code for the whole survey. Every
+// file is checked even when earlier ones have problems.
+func runSurvey(w io.Writer, jobs []editJob, opts runOptions) int {
+	opts.dryRun = true
+
+	entries := make([]surveyEntry, len(jobs))
+	for i, job := range jobs {
+		err := job.err
+		var result editResult
+		if err == nil {
+			result, err = editFile(job.filename, job.edit, opts)
+		}
+		entries[i] = surveyEntry{filename: job.filename, status: surveyStatus(result, err), err: err}
+	}
+	writeSurvey(w, entries)
+
+	counts := map[string]int{}
+	for _, entry := range entries {
+		counts[entry.status]++
+	}
+	switch {
+	case counts[surveyNotFound]+counts[surveyAmbiguous]+counts[surveyFailed] > 0:
+		return 1
+	case counts[surveyPartial] > 0:
+		return exitPartial
+	}
+	return 0
+}
+
+// surveyStatus classifies the outcome of a dry run. Files that are already
+// up to date or skipped by a guard need no change, so they count as
+// applying.
+func surveyStatus(result editResult, err error) string {
+	switch {
+	case errors.Is(err, errSearchNotFound):
+		return surveyNotFound
+	case errors.Is(err, errAmbiguous):
+		return surveyAmbiguous
+	case err != nil:
+		return surveyFailed
+	case len(result.skippedBlocks()) > 0:
+		return surveyPartial
+	}
+	return surveyApplies
+}
+
+// writeSurvey prints one row per file followed by the aggregate verdict.
+func writeSurvey(w io.Writer, entries []surveyEntry) {
+	width := len("FILE")
+	for _, entry := range entries {
+		width = max(width, len(entry.filename))
+	}
+
+	fmt.Fprintf(w, "%-*s  %s\n", width, "FILE", "RESULT")
+	counts := map[string]int{}
+	for _, entry := range entries {
+		counts[entry.status]++
+		status := entry.status
+		if entry.status == surveyFailed {
+			// Only the first line, other detail would break up the table
+			status += ": " + firstLine(entry.err.Error())
+		}
+		fmt.Fprintf(w, "%-*s  %s\n", width, entry.filename, status)
+	}
+
+	fmt.Fprintf(w, "%d of %d files would apply", counts[surveyApplies], len(entries))
+	var problems []string
+	for _, status := range []string{surveyPartial, surveyNotFound, surveyAmbiguous, surveyFailed} {
+		if counts[status] > 0 {
+			problems = append(problems, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(w, " (%s)", strings.Join(problems, ", "))
+	}
+	fmt.Fprintln(w)
+}
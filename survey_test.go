@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunSurvey(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"unique.txt":    "foo\n",
+		"missing.txt":   "bar\n",
+		"ambiguous.txt": "foo\nfoo\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var jobs []editJob
+	for _, name := range []string{"unique.txt", "missing.txt", "ambiguous.txt"} {
+		jobs = append(jobs, editJob{filename: filepath.Join(dir, name), edit: searchReplace("foo", "baz", editOptions{})})
+	}
+	jobs = append(jobs, editJob{filename: "broken.txt", err: errors.New("parsing diff: bad\nmore detail")})
+
+	var out bytes.Buffer
+	code := runSurvey(&out, jobs, runOptions{})
+	if code != 1 {
+		t.Errorf("runSurvey() = %d, want 1", code)
+	}
+
+	width := len(filepath.Join(dir, "ambiguous.txt"))
+	pad := func(s string) string {
+		return s + string(bytes.Repeat([]byte(" "), width-len(s)))
+	}
+	want := pad("FILE") + "  RESULT\n" +
+		pad(filepath.Join(dir, "unique.txt")) + "  applies\n" +
+		pad(filepath.Join(dir, "missing.txt")) + "  not found\n" +
+		pad(filepath.Join(dir, "ambiguous.txt")) + "  ambiguous\n" +
+		pad("broken.txt") + "  failed: parsing diff: bad\n" +
+		"1 of 4 files would apply (1 not found, 1 ambiguous, 1 failed)\n"
+	if out.String() != want {
+		t.Errorf("runSurvey() output:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want it untouched", name, got)
+		}
+	}
+}
+
+func TestRunSurveyAllApply(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(file, []byte("foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	code := runSurvey(&out, []editJob{{filename: file, edit: searchReplace("foo", "bar", editOptions{})}}, runOptions{})
+	if code != 0 {
+		t.Errorf("runSurvey() = %d, want 0", code)
+	}
+	if !bytes.HasSuffix(out.Bytes(), []byte("1 of 1 files would apply\n")) {
+		t.Errorf("runSurvey() output = %q, want the all-apply verdict", out.String())
+	}
+}
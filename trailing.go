@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// trailingContextLines returns the lines of context, or false unless there
+// are exactly n of them. Checking only some of them would silently drop the
+// rest, which is weaker than using --context-after as a filter.
+func trailingContextLines(context string, n int) ([]string, bool) {
+	lines := strings.Split(strings.TrimSuffix(context, "\n"), "\n")
+	if context == "" || len(lines) != n {
+		return nil, false
+	}
+	return lines, true
+}
+
+// checkTrailingContext verifies that the lines following a match ending at
+// end are the n lines of context. A match that ends within a line is
+// followed by the rest of that line, or by the next line if it ends right
+// before a line break, as with --context-after.
+func checkTrailingContext(content string, end int, context string, n int) error {
+	want, ok := trailingContextLines(context, n)
+	if !ok {
+		return fmt.Errorf("trailing context must have exactly %d lines", n)
+	}
+
+	line := strings.Count(content[:end], "\n") + 1
+	after := content[end:]
+	if end > 0 && content[end-1] != '\n' && strings.HasPrefix(after, "\n") {
+		after = after[1:]
+		line++
+	}
+
+	got := strings.Split(after, "\n")
+	if strings.HasSuffix(after, "\n") || after == "" {
+		got = got[:len(got)-1]
+	}
+	for i, w := range want {
+		if i >= len(got) {
+			return fmt.Errorf("trailing context doesn't line up: the file ends %d lines after the match, expected %d lines of context", i, n)
+		}
+		if got[i] != w {
+			return fmt.Errorf("trailing context doesn't line up: line %d is %q, expected %q", line+i, got[i], w)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckTrailingContext(t *testing.T) {
+	content := "func a() {\n\treturn\n}\n\nfunc b() {\n}\n"
+	tests := []struct {
+		name        string
+		match       string
+		context     string
+		n           int
+		errContains string
+	}{
+		{name: "lines follow", match: "\treturn\n", context: "}\n\nfunc b() {", n: 3},
+		{name: "match ending mid-line", match: "\treturn", context: "}", n: 1},
+		{name: "rest of the line", match: "\tret", context: "urn\n}", n: 2},
+		{name: "mismatch", match: "\treturn\n", context: "}\nfunc b() {", n: 2, errContains: `line 4 is "", expected "func b() {"`},
+		{name: "end of file", match: "func b() {\n", context: "}\n\nfunc c() {", n: 3, errContains: "the file ends 1 lines after the match, expected 3"},
+		{name: "short context", match: "\treturn\n", context: "}", n: 2, errContains: "exactly 2 lines"},
+		{name: "long context", match: "\treturn\n", context: "}\nWRONG", n: 1, errContains: "exactly 1 lines"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			end := strings.Index(content, tt.match) + len(tt.match)
+			err := checkTrailingContext(content, end, tt.context, tt.n)
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("checkTrailingContext() error = %v, want error containing %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("checkTrailingContext() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestApplyEditTrailingContextCount(t *testing.T) {
+	content := "if err != nil {\n\treturn err\n}\nlog()\nif err != nil {\n\treturn err\n}\ndone()\n"
+	opts := editOptions{contextAfter: "}\ndone()", trailingContextCount: 2}
+
+	// As a filter, --context-after would pick the second occurrence; as a
+	// guard it makes the ambiguity an error instead of choosing for us
+	if _, err := applyEdit(content, "\treturn err\n", "\treturn nil\n", opts); err == nil {
+		t.Fatal("applyEdit() error = nil, want ambiguity error")
+	}
+
+	_, err := applyEdit(content, "log()\nif err != nil {\n\treturn err\n", "log()\nif err != nil {\n\treturn nil\n", editOptions{contextAfter: "}\nlog()", trailingContextCount: 2})
+	if err == nil || !strings.Contains(err.Error(), `line 8 is "done()", expected "log()"`) {
+		t.Errorf("applyEdit() error = %v, want trailing context mismatch", err)
+	}
+
+	result, err := applyEdit(content, "log()\nif err != nil {\n\treturn err\n", "log()\nif err != nil {\n\treturn nil\n", opts)
+	if err != nil {
+		t.Fatalf("applyEdit() error = %v", err)
+	}
+	if want := "if err != nil {\n\treturn err\n}\nlog()\nif err != nil {\n\treturn nil\n}\ndone()\n"; result.content != want {
+		t.Errorf("applyEdit() = %q, want %q", result.content, want)
+	}
+}
+
+func TestApplyEditTrailingContextCountLongerContext(t *testing.T) {
+	// Lines past the count must not be dropped from the check
+	_, err := applyEdit("x = 1\na\nWRONG\n", "x = 1\n", "x = 2\n", editOptions{contextAfter: "a\nb", trailingContextCount: 1})
+	if err == nil {
+		t.Fatal("applyEdit() error = nil, want error")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// maxWildcardMatches bounds how many matches of a search block with wildcard
+// lines are collected. Only whether there is exactly one matters for the
+// edit, so the combinations of anchors aren't enumerated beyond it.
+const maxWildcardMatches = 100
+
+// isWildcardLine reports whether line is the wildcard line sentinel, ignoring
+// surrounding whitespace. An empty sentinel disables wildcard lines.
+func isWildcardLine(line, sentinel string) bool {
+	return sentinel != "" && strings.TrimSpace(line) == sentinel
+}
+
+// splitWildcard splits search at its wildcard lines into the anchors around
+// them. Consecutive wildcard lines count as one. A search block without
+// wildcard lines, or with one as its first or last line, is a single anchor.
+func splitWildcard(search, sentinel string) []string {
+	lines := strings.Split(search, "\n")
+	if sentinel == "" || isWildcardLine(lines[0], sentinel) || isWildcardLine(lines[len(lines)-1], sentinel) {
+		return []string{search}
+	}
+	var anchors []string
+	start := 0
+	for i, line := range lines {
+		if !isWildcardLine(line, sentinel) {
+			continue
+		}
+		if i > start {
+			anchors = append(anchors, strings.Join(lines[start:i], "\n"))
+		}
+		start = i + 1
+	}
+	return append(anchors, strings.Join(lines[start:], "\n"))
+}
+
+// checkWildcard rejects a search block that starts or ends with a wildcard
+// line, which would leave the extent of the match open.
+func checkWildcard(search, sentinel string) error {
+	lines := strings.Split(search, "\n")
+	if isWildcardLine(lines[0], sentinel) || isWildcardLine(lines[len(lines)-1], sentinel) {
+		return errors.New("the search block can't start or end with a wildcard line")
+	}
+	return nil
+}
+
+// wildcardMatches returns every region of content that the anchors match in
+// order, each anchor starting on a line of its own after the line the
+// previous one ended on, with any number of lines in between. Every way of
+// picking the anchors counts, so an anchor that occurs twice within reach
+// makes the match ambiguous.
+func wildcardMatches(content string, anchors []string, opts editOptions) []span {
+	occurrences := make([][]span, len(anchors))
+	for i, anchor := range anchors {
+		for _, m := range findMatches(content, anchor, opts) {
+			startsLine := m.start == 0 || content[m.start-1] == '\n'
+			endsLine := m.end == len(content) || content[m.end] == '\n'
+			if (i == 0 || startsLine) && (i == len(anchors)-1 || endsLine) {
+				occurrences[i] = append(occurrences[i], m)
+			}
+		}
+	}
+
+	// latest[i] is the last offset at which anchor i can start and still
+	// be followed by the rest of the anchors. Branches that start later
+	// anchors beyond it are never explored, so that a search that can't
+	// match doesn't try every combination of anchors
+	latest := make([]int, len(anchors))
+	for i := len(anchors) - 1; i >= 0; i-- {
+		latest[i] = -1
+		for _, m := range occurrences[i] {
+			if i == len(anchors)-1 || m.end+1 <= latest[i+1] {
+				latest[i] = max(latest[i], m.start)
+			}
+		}
+		if latest[i] == -1 {
+			return nil
+		}
+	}
+
+	var matches []span
+	var extend func(i, start, from int)
+	extend = func(i, start, from int) {
+		for _, m := range occurrences[i] {
+			if len(matches) == maxWildcardMatches || opts.ctx != nil && opts.ctx.Err() != nil {
+				return
+			}
+			if m.start < from {
+				continue
+			}
+			if m.start > latest[i] {
+				return
+			}
+			if i == 0 {
+				start = m.start
+			}
+			if i == len(anchors)-1 {
+				matches = append(matches, span{start, m.end})
+				continue
+			}
+			// The next anchor starts after the line break ending this one
+			if m.end+1 <= latest[i+1] {
+				extend(i+1, start, m.end+1)
+			}
+		}
+	}
+	extend(0, 0, 0)
+	return matches
+}
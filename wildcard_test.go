@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitWildcard(t *testing.T) {
+	tests := []struct {
+		name   string
+		search string
+		want   []string
+	}{
+		{"no wildcard", "a\nb", []string{"a\nb"}},
+		{"one wildcard", "a\n...\nb\nc", []string{"a", "b\nc"}},
+		{"indented wildcard", "a\n    ...\nb", []string{"a", "b"}},
+		{"consecutive wildcards", "a\n...\n...\nb", []string{"a", "b"}},
+		{"leading wildcard", "...\nb", []string{"...\nb"}},
+		{"part of a line", "a...\nb", []string{"a...\nb"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitWildcard(tt.search, "..."); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitWildcard(%q) = %q, want %q", tt.search, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditWildcardLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		search  string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "skips the lines in between",
+			content: "x\nfunc f() {\n\tone()\n\ttwo()\n}\ny\n",
+			search:  "func f() {\n...\n}",
+			want:    "x\nREPLACED\ny\n",
+		},
+		{
+			name:    "no lines in between",
+			content: "a\nb\nc\n",
+			search:  "a\n...\nb",
+			want:    "REPLACED\nc\n",
+		},
+		{
+			name:    "anchors must be on lines of their own",
+			content: "start end\n",
+			search:  "start\n...\nend",
+			wantErr: errSearchNotFound,
+		},
+		{
+			name:    "second anchor occurs twice",
+			content: "begin\n}\nx\n}\n",
+			search:  "begin\n...\n}",
+			wantErr: errAmbiguous,
+		},
+		{
+			name:    "first anchor occurs twice",
+			content: "begin\nbegin\nend\n",
+			search:  "begin\n...\nend",
+			wantErr: errAmbiguous,
+		},
+		{
+			name:    "anchor missing",
+			content: "begin\nmiddle\n",
+			search:  "begin\n...\nend",
+			wantErr: errSearchNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyEdit(tt.content, tt.search, "REPLACED", editOptions{wildcardLine: "..."})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyEdit() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit() error = %v", err)
+			}
+			if result.content != tt.want {
+				t.Errorf("applyEdit() = %q, want %q", result.content, tt.want)
+			}
+		})
+	}
+}
+
+func TestWildcardMatchesPrunes(t *testing.T) {
+	// Without pruning, every combination of the first four anchors would be
+	// tried before finding that B never follows them
+	content := strings.Repeat("A\n", 2000)
+	anchors := []string{"A", "A", "A", "A", "B"}
+	if matches := wildcardMatches(content, anchors, editOptions{}); matches != nil {
+		t.Errorf("wildcardMatches() = %v, want none", matches)
+	}
+
+	content = strings.Repeat("A\n", 2000) + "B\n"
+	if matches := wildcardMatches(content, anchors, editOptions{}); len(matches) != maxWildcardMatches {
+		t.Errorf("wildcardMatches() found %d matches, want %d", len(matches), maxWildcardMatches)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if matches := wildcardMatches(content, anchors, editOptions{ctx: ctx}); matches != nil {
+		t.Errorf("wildcardMatches() = %v after cancellation, want none", matches)
+	}
+}
+
+func TestCheckWildcard(t *testing.T) {
+	if err := checkWildcard("a\n...\nb", "..."); err != nil {
+		t.Errorf("checkWildcard() error = %v", err)
+	}
+	for _, search := range []string{"...\nb", "a\n..."} {
+		if err := checkWildcard(search, "..."); err == nil {
+			t.Errorf("checkWildcard(%q) succeeded, want an error", search)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ANSI styles used by the word diff.
+const (
+	styleRemoved = "\x1b[31m"
+	styleAdded   = "\x1b[32m"
+	styleReset   = "\x1b[m"
+)
+
+// wordEdit is a run of tokens that was kept, removed ('-') or added ('+').
+type wordEdit struct {
+	op   byte
+	text string
+}
+
+// writeWordDiff prints the region like writePreview, but as a single text in
+// which the words that changed are highlighted.
+func writeWordDiff(w io.Writer, filename string, p preview) {
+	writeHunkHeader(w, filename, p)
+	for _, line := range p.context[0] {
+		fmt.Fprintln(w, line)
+	}
+
+	edits := diffWords(strings.Join(p.before, "\n"), strings.Join(p.after, "\n"))
+	for _, edit := range edits {
+		style := ""
+		switch edit.op {
+		case '-':
+			style = styleRemoved
+		case '+':
+			style = styleAdded
+		}
+		if style == "" {
+			io.WriteString(w, edit.text)
+			continue
+		}
+		// Style each line separately so that no style runs across a
+		// line break
+		for i, part := range strings.Split(edit.text, "\n") {
+			if i > 0 {
+				io.WriteString(w, "\n")
+			}
+			if part != "" {
+				io.WriteString(w, style+part+styleReset)
+			}
+		}
+	}
+	if len(p.before) > 0 || len(p.after) > 0 {
+		io.WriteString(w, "\n")
+	}
+
+	for _, line := range p.context[1] {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// diffWords returns the edits turning a into b, comparing them word by word.
+// Consecutive tokens with the same operation are merged into one edit.
+func diffWords(a, b string) []wordEdit {
+	x, y := tokenize(a), tokenize(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []wordEdit
+	add := func(op byte, text string) {
+		if n := len(edits); n > 0 && edits[n-1].op == op {
+			edits[n-1].text += text
+			return
+		}
+		edits = append(edits, wordEdit{op, text})
+	}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			add(' ', x[i])
+			i++
+			j++
+		case j == len(y) || i < len(x) && lcs[i+1][j] >= lcs[i][j+1]:
+			add('-', x[i])
+			i++
+		default:
+			add('+', y[j])
+			j++
+		}
+	}
+	return edits
+}
+
+// tokenize splits s into words, runs of blanks, line breaks and single
+// punctuation characters, which together make up s.
+func tokenize(s string) []string {
+	class := func(r rune) int {
+		switch {
+		case r == '\n':
+			return 0
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 3
+	}
+
+	var tokens []string
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		c := class(r)
+		end := size
+		// Words and blanks extend over characters of the same class
+		for (c == 1 || c == 2) && end < len(s) {
+			next, size := utf8.DecodeRuneInString(s[end:])
+			if class(next) != c {
+				break
+			}
+			end += size
+		}
+		tokens = append(tokens, s[:end])
+		s = s[end:]
+	}
+	return tokens
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("port = 8080,  héllo_1\n")
+	want := []string{"port", " ", "=", " ", "8080", ",", "  ", "héllo_1", "\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokenize() = %q, want %q", got, want)
+	}
+}
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []wordEdit
+	}{
+		{
+			name: "changed word",
+			a:    "the quick fox",
+			b:    "the slow fox",
+			want: []wordEdit{{' ', "the "}, {'-', "quick"}, {'+', "slow"}, {' ', " fox"}},
+		},
+		{
+			name: "added words",
+			a:    "a b",
+			b:    "a new b",
+			want: []wordEdit{{' ', "a "}, {'+', "new "}, {' ', "b"}},
+		},
+		{
+			name: "identical",
+			a:    "same",
+			b:    "same",
+			want: []wordEdit{{' ', "same"}},
+		},
+		{
+			name: "removed everything",
+			a:    "gone",
+			b:    "",
+			want: []wordEdit{{'-', "gone"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffWords(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffWords() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteWordDiff(t *testing.T) {
+	p := preview{
+		matchLine: 2,
+		before:    []string{"timeout = 30", "retries = 3"},
+		after:     []string{"timeout = 60", "retries = 3"},
+		context:   [2][]string{{"[server]"}, {"debug = false"}},
+	}
+
+	var buf strings.Builder
+	writeWordDiff(&buf, "app.toml", p)
+
+	want := "--- app.toml\n+++ app.toml\n@@ -1,4 +1,4 @@\n" +
+		"[server]\n" +
+		"timeout = " + styleRemoved + "30" + styleReset + styleAdded + "60" + styleReset + "\n" +
+		"retries = 3\n" +
+		"debug = false\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeWordDiff() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// writeFile writes data to filename, atomically if opts.atomic or opts.timeout
+// is set. If opts.chmodWritable is set and the write fails because the file is
+// read-only, the owner-write bit is added for the duration of the write and
+// the original mode restored afterwards.
+func writeFile(filename string, data []byte, opts runOptions) error {
+	write := func() error {
+		return os.WriteFile(filename, data, 0644)
+	}
+	if opts.atomic || opts.timeout > 0 {
+		write = func() error {
+			return writeFileAtomic(filename, data, opts.chmodWritable)
+		}
+	}
+
+	err := write()
+	if err == nil || !opts.chmodWritable || !errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+
+	info, statErr := os.Stat(filename)
+	if statErr != nil {
+		return err
+	}
+	mode := info.Mode().Perm()
+	if mode&0200 != 0 {
+		// Already owner-writable, so the mode is not what is stopping us
+		return err
+	}
+
+	if err := os.Chmod(filename, mode|0200); err != nil {
+		return err
+	}
+	writeErr := write()
+	if err := os.Chmod(filename, mode); err != nil && writeErr == nil {
+		return err
+	}
+	return writeErr
+}
+
+// writeFileAtomic writes data to a temporary file next to filename and renames
+// it into place, so readers never observe a partially written file. The
+// original mode and, where permitted, ownership are carried over. A file
+// that doesn't exist yet is created with mode 0644.
+func writeFileAtomic(filename string, data []byte, chmodWritable bool) error {
+	mode := fs.FileMode(0644)
+	info, err := os.Stat(filename)
+	switch {
+	case err == nil:
+		mode = info.Mode().Perm()
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	// Renaming over a read-only file would succeed, so check that the file
+	// itself is writable to keep the same semantics as a direct write.
+	if info != nil && !chmodWritable {
+		f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return err
+	}
+
+	if info != nil {
+		preserveOwner(filename, info)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	filename := filepath.Join(t.TempDir(), "readonly.txt")
+	if err := os.WriteFile(filename, []byte("old"), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	err := writeFile(filename, []byte("new"), runOptions{})
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Fatalf("writeFile() without chmodWritable error = %v, want permission error", err)
+	}
+
+	if err := writeFile(filename, []byte("new"), runOptions{chmodWritable: true}); err != nil {
+		t.Fatalf("writeFile() with chmodWritable error = %v", err)
+	}
+
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "new" {
+		t.Errorf("content = %q, want %q", got, "new")
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0444 {
+		t.Errorf("mode = %v, want %v", mode, fs.FileMode(0444))
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(filename, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFile(filename, []byte("new"), runOptions{atomic: true}); err != nil {
+		t.Fatalf("writeFile() error = %v", err)
+	}
+
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "new" {
+		t.Errorf("content = %q, want %q", got, "new")
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("mode = %v, want %v", mode, fs.FileMode(0600))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("found %d entries in directory, want only the edited file", len(entries))
+	}
+}